@@ -1,43 +1,205 @@
 package main
 
 import (
-	"net/http"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 
+	"upload-drive-script/internal/auth"
 	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/cors"
+	"upload-drive-script/internal/dedupe"
+	"upload-drive-script/internal/download"
 	"upload-drive-script/internal/handlers"
+	"upload-drive-script/internal/history"
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/resolver"
+	"upload-drive-script/internal/safefetch"
+	"upload-drive-script/internal/storage"
+	"upload-drive-script/internal/tus"
+	"upload-drive-script/internal/urlsign"
 	"upload-drive-script/pkg/logger"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	store, err := storage.NewFromConfig()
+	if err != nil {
+		logger.Error("erro ao configurar armazenamento: " + err.Error())
+		return
+	}
+	refs := storage.NewRefTracker()
+	handlers.SetStorage(store, refs)
+
+	policy := storage.RetentionPolicy{
+		MaxAge:        config.RetentionMaxAge(),
+		MaxTotalBytes: config.RetentionMaxBytes(),
+		MaxFiles:      config.RetentionMaxFiles(),
+	}
+	if policy.Enabled() {
+		go storage.NewJanitor(store, policy, refs).Run(context.Background(), config.RetentionInterval())
+	}
+
+	// Um perfil padrão inválido faria todo pedido sem audio_profile falhar com 400
+	if name := config.DefaultAudioProfile(); !isAudioProfile(name) {
+		logger.Error(fmt.Sprintf("AUDIO_DEFAULT_PROFILE desconhecido: %s (disponíveis: %s)", name, strings.Join(media.AudioProfileNames(), ", ")))
+		return
+	}
+
+	if secret := config.SignedURLSecret(); secret != "" {
+		handlers.SetURLSigner(urlsign.NewSigner(secret))
+	} else if config.SignedURLRequired() {
+		logger.Error("SIGNED_URL_REQUIRED exige SIGNED_URL_SECRET")
+		return
+	}
+
+	remotePolicy, err := safefetch.NewPolicy(safefetch.Config{
+		AllowHosts: config.RemoteAllowedHosts(),
+		DenyHosts:  config.RemoteDeniedHosts(),
+		AllowCIDRs: config.RemoteAllowedCIDRs(),
+		DenyCIDRs:  config.RemoteDeniedCIDRs(),
+	})
+	if err != nil {
+		logger.Error("erro ao configurar downloads remotos: " + err.Error())
+		return
+	}
+	handlers.SetRemotePolicy(remotePolicy)
+	handlers.SetRemoteDownloader(&download.Downloader{
+		Client: safefetch.NewClient(remotePolicy, safefetch.Timeouts{
+			Connect: config.RemoteConnectTimeout(),
+			Header:  config.RemoteHeaderTimeout(),
+			Idle:    config.RemoteIdleTimeout(),
+		}),
+		Dir:             config.DownloadDir(),
+		MaxSize:         config.MaxFileSize(),
+		Retries:         config.DownloadRetries(),
+		Connections:     config.DownloadConnections(),
+		ParallelMinSize: config.DownloadParallelMinSize(),
+		PartialTTL:      config.DownloadPartialTTL(),
+	})
+
+	resolvers := []resolver.Resolver{resolver.GoogleDrive{}, resolver.Dropbox{}, resolver.OneDrive{}}
+	if config.URLExtractorEnabled() {
+		if command, err := exec.LookPath(config.URLExtractorCommand()); err == nil {
+			resolvers = append(resolvers, &resolver.Extractor{
+				Command: command,
+				Args:    config.URLExtractorArgs(),
+				Format:  config.URLExtractorFormat(),
+				Hosts:   config.URLExtractorHosts(),
+				Timeout: config.URLExtractorTimeout(),
+			})
+		} else {
+			logger.Info("extrator de vídeos desabilitado: " + config.URLExtractorCommand() + " não encontrado")
+		}
+	}
+	handlers.SetURLResolvers(resolver.NewRegistry(resolvers...))
+
+	tusStore, err := tus.NewStore(config.TusDir(), config.TusExpiration())
+	if err != nil {
+		logger.Error("erro ao configurar uploads tus: " + err.Error())
+		return
+	}
+	handlers.SetTusStore(tusStore)
+
+	dedupeIndex, err := dedupe.NewIndex(config.DedupeIndexDir())
+	if err != nil {
+		logger.Error("erro ao configurar índice de duplicados: " + err.Error())
+		return
+	}
+	handlers.SetDedupeIndex(dedupeIndex)
+
+	historyStore, err := history.Open(config.HistoryFile())
+	if err != nil {
+		logger.Error("erro ao abrir histórico de uploads: " + err.Error())
+		return
+	}
+	defer historyStore.Close()
+	// O histórico em JSON Lines de versões anteriores é importado uma única vez
+	if legacy := config.LegacyHistoryFile(); fileExists(legacy) {
+		added, err := historyStore.Import(legacy)
+		if err != nil {
+			logger.Error("erro ao importar histórico de uploads: " + err.Error())
+			return
+		}
+		logger.Info(fmt.Sprintf("histórico de uploads: %d registro(s) importado(s) de %s", added, legacy))
+		if err := os.Rename(legacy, legacy+".imported"); err != nil {
+			logger.Error("erro ao renomear histórico importado: " + err.Error())
+		}
+	}
+	handlers.SetHistoryStore(historyStore)
+
+	handlers.SetJobManager(jobs.NewManager(config.JobWorkers(), config.JobQueueSize(), config.JobRetention()))
+
+	var keyring *auth.Keyring
+	if path := config.APIKeysFile(); path != "" {
+		if keyring, err = auth.LoadKeyring(path); err != nil {
+			logger.Error("erro ao carregar API keys: " + err.Error())
+			return
+		}
+	}
+	apiKey := func(scopes ...string) gin.HandlerFunc {
+		return auth.RequireAPIKey(keyring, config.APISignatureMaxSkew(), scopes...)
+	}
+
 	r := gin.Default()
 
 	r.MaxMultipartMemory = 500 << 20
-	r.Use(allowAllCORS())
+	corsPolicy, err := cors.New(cors.Config{
+		AllowedOrigins:   config.CORSAllowedOrigins(),
+		AllowedHeaders:   config.CORSAllowedHeaders(),
+		ExposedHeaders:   config.CORSExposedHeaders(),
+		AllowCredentials: config.CORSAllowCredentials(),
+		MaxAge:           config.CORSMaxAge(),
+	})
+	if err != nil {
+		logger.Error("erro ao configurar CORS: " + err.Error())
+		return
+	}
+	r.Use(corsPolicy.Middleware())
+
+	driveAuth := func(c *gin.Context) { c.Next() }
+	if config.AuthVerifyTokens() {
+		verifier := auth.NewCachingVerifier(auth.NewTokenInfoVerifier(), config.AuthTokenCacheTTL())
+		driveAuth = auth.RequireDriveToken(verifier, handlers.UsesForwardedToken)
+	}
 
-	r.POST("/upload", handlers.Upload)
-	r.POST("/upload-url", handlers.UploadURL)
-	r.GET("/uploads/:filename", handlers.GetUploadedFile)
+	r.POST("/upload", apiKey(auth.ScopeUpload), driveAuth, handlers.Upload)
+	r.POST("/upload-url", apiKey(auth.ScopeUploadURL), driveAuth, handlers.UploadURL)
+	r.POST("/upload-url/batch", apiKey(auth.ScopeUploadURL), driveAuth, handlers.UploadURLBatch)
+	r.POST("/probe", apiKey(auth.ScopeUpload, auth.ScopeUploadURL), handlers.Probe)
+	r.POST("/upload-sessions", apiKey(auth.ScopeUpload), driveAuth, handlers.CreateUploadSession)
+	r.POST("/upload-sessions/:id/complete", apiKey(auth.ScopeUpload), driveAuth, handlers.CompleteUploadSession)
+	r.OPTIONS("/tus", handlers.TusResumable(), handlers.TusOptions)
+	r.POST("/tus", handlers.TusResumable(), apiKey(auth.ScopeUpload), driveAuth, handlers.TusCreate)
+	r.HEAD("/tus/:id", handlers.TusResumable(), apiKey(auth.ScopeUpload), handlers.TusHead)
+	r.PATCH("/tus/:id", handlers.TusResumable(), apiKey(auth.ScopeUpload), driveAuth, handlers.TusPatch)
+	r.DELETE("/tus/:id", handlers.TusResumable(), apiKey(auth.ScopeUpload), handlers.TusDelete)
+	r.GET("/uploads", apiKey(auth.ScopeAdmin), handlers.RequireAdmin(), handlers.ListUploads)
+	r.GET("/uploads/:filename/meta", apiKey(auth.ScopeAdmin), handlers.RequireAdmin(), handlers.GetUploadMeta)
+	r.GET("/uploads/:filename", handlers.RequireUploadAccess(apiKey(auth.ScopeUploadsRead)), handlers.GetUploadedFile)
+	r.POST("/uploads/:filename/sign", apiKey(auth.ScopeUploadsRead), handlers.RequireSignPermission(), handlers.SignUploadedFile)
+	r.GET("/streams/:id/*file", handlers.RequireStreamAccess(apiKey(auth.ScopeUploadsRead)), handlers.GetStreamFile)
+	r.DELETE("/uploads/:filename", apiKey(auth.ScopeAdmin), handlers.RequireAdmin(), handlers.DeleteUploadedFile)
+	r.GET("/jobs", apiKey(auth.ScopeUpload, auth.ScopeUploadURL), driveAuth, handlers.ListJobs)
+	r.GET("/jobs/:id", apiKey(auth.ScopeUpload, auth.ScopeUploadURL), driveAuth, handlers.GetJob)
+
+	corsPolicy.SetRoutes(r.Routes())
 
 	if err := r.Run(config.ServerPort()); err != nil {
 		logger.Error("erro ao iniciar servidor: " + err.Error())
 	}
 }
 
-func allowAllCORS() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		headers := c.Writer.Header()
-		headers.Set("Access-Control-Allow-Origin", "*")
-		headers.Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-		headers.Set("Access-Control-Allow-Headers", "Authorization,Content-Type,Origin,Accept")
-		headers.Set("Access-Control-Expose-Headers", "Content-Disposition")
-
-		if c.Request.Method == http.MethodOptions {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
 
-		c.Next()
-	}
+func isAudioProfile(name string) bool {
+	_, ok := media.LookupAudioProfile(name)
+	return ok
 }
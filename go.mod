@@ -4,6 +4,7 @@ go 1.25
 
 require (
 	github.com/gin-gonic/gin v1.11.0
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/oauth2 v0.32.0
 	google.golang.org/api v0.252.0
 )
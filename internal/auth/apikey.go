@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/pkg/logger"
+)
+
+// Escopos que podem ser concedidos a uma API key.
+const (
+	ScopeUpload      = "upload"
+	ScopeUploadURL   = "upload-url"
+	ScopeUploadsRead = "uploads:read"
+	ScopeAdmin       = "admin"
+)
+
+const (
+	callerKey = "auth.api_key"
+
+	// Corpos não multipart até esse tamanho são verificados antes do handler
+	maxEagerBodyHash = 10 << 20
+)
+
+var errBodyHashMismatch = errors.New("corpo da requisição não corresponde a X-Content-Sha256")
+
+// APIKey is one entry of the keys file.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Secret    string     `json:"secret"`
+	Scopes    []string   `json:"scopes"`
+	Revoked   bool       `json:"revoked,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (k *APIKey) active(now time.Time) bool {
+	return !k.Revoked && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key was granted scope. The admin scope
+// grants every other scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// Keyring holds the API keys loaded from a JSON file. The file is re-read
+// whenever it changes, so revoking a key does not require a restart.
+type Keyring struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	keys    []APIKey
+}
+
+type keysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// LoadKeyring reads the keys file at path.
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Keyring) reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return fmt.Errorf("ler arquivo de API keys: %w", err)
+	}
+	if info.ModTime().Equal(k.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("ler arquivo de API keys: %w", err)
+	}
+	var file keysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("decodificar arquivo de API keys: %w", err)
+	}
+
+	seen := make(map[string]bool, len(file.Keys))
+	for _, key := range file.Keys {
+		if key.ID == "" || key.Secret == "" {
+			return errors.New("arquivo de API keys: toda key precisa de id e secret")
+		}
+		if seen[key.ID] {
+			return fmt.Errorf("arquivo de API keys: id duplicado %q", key.ID)
+		}
+		seen[key.ID] = true
+	}
+
+	k.keys = file.Keys
+	k.modTime = info.ModTime()
+	return nil
+}
+
+// snapshot recarrega o arquivo se ele mudou; em caso de erro mantém as keys anteriores.
+func (k *Keyring) snapshot() []APIKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(); err != nil {
+		logger.Error(err.Error())
+	}
+	return k.keys
+}
+
+func (k *Keyring) byID(id string) (*APIKey, bool) {
+	for _, key := range k.snapshot() {
+		if key.ID == id {
+			return &key, true
+		}
+	}
+	return nil, false
+}
+
+func (k *Keyring) bySecret(secret string) (*APIKey, bool) {
+	var found *APIKey
+	for _, key := range k.snapshot() {
+		// Percorre todas as keys para que o tempo de resposta não revele qual delas bateu
+		if subtle.ConstantTimeCompare([]byte(key.Secret), []byte(secret)) == 1 {
+			found = &key
+		}
+	}
+	return found, found != nil
+}
+
+// RequireAPIKey authenticates our own callers, either with a static key
+// (X-Api-Key) or an HMAC-signed request (X-Api-Key-Id, X-Api-Timestamp,
+// X-Content-Sha256 and X-Api-Signature), and requires one of scopes.
+//
+// The signature is hex(HMAC-SHA256(secret, METHOD\nREQUEST_URI\nTIMESTAMP\nBODY_SHA256)).
+// A nil keyring disables the check.
+func RequireAPIKey(ring *Keyring, maxSkew time.Duration, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ring == nil {
+			c.Next()
+			return
+		}
+
+		var key *APIKey
+		var err error
+		if c.GetHeader("X-Api-Signature") != "" {
+			key, err = verifySignedRequest(c, ring, maxSkew)
+		} else if secret := c.GetHeader("X-Api-Key"); secret != "" {
+			var ok bool
+			if key, ok = ring.bySecret(secret); !ok {
+				err = errors.New("API key inválida")
+			}
+		} else {
+			err = errors.New("API key ausente")
+		}
+		if err == nil && !key.active(time.Now()) {
+			err = errors.New("API key revogada ou expirada")
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		allowed := len(scopes) == 0
+		for _, scope := range scopes {
+			allowed = allowed || key.HasScope(scope)
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key sem permissão para esta rota (escopo necessário: " + strings.Join(scopes, " ou ") + ")"})
+			return
+		}
+
+		c.Set(callerKey, key)
+		c.Next()
+	}
+}
+
+// Caller returns the API key authenticated by RequireAPIKey.
+func Caller(c *gin.Context) (*APIKey, bool) {
+	value, ok := c.Get(callerKey)
+	if !ok {
+		return nil, false
+	}
+	key, ok := value.(*APIKey)
+	return key, ok
+}
+
+func verifySignedRequest(c *gin.Context, ring *Keyring, maxSkew time.Duration) (*APIKey, error) {
+	key, ok := ring.byID(c.GetHeader("X-Api-Key-Id"))
+	if !ok {
+		return nil, errors.New("API key inválida")
+	}
+
+	timestamp := c.GetHeader("X-Api-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("X-Api-Timestamp inválido")
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > maxSkew || skew < -maxSkew {
+		return nil, errors.New("assinatura expirada: verifique o relógio do cliente")
+	}
+
+	bodyHash := strings.ToLower(c.GetHeader("X-Content-Sha256"))
+	expectedHash, err := hex.DecodeString(bodyHash)
+	if err != nil || len(expectedHash) != sha256.Size {
+		return nil, errors.New("X-Content-Sha256 inválido")
+	}
+
+	mac := hmac.New(sha256.New, []byte(key.Secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", c.Request.Method, c.Request.URL.RequestURI(), timestamp, bodyHash)
+	signature, err := hex.DecodeString(c.GetHeader("X-Api-Signature"))
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.New("assinatura inválida")
+	}
+
+	if err := bindBodyHash(c.Request, expectedHash); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// bindBodyHash garante que o corpo corresponde ao hash assinado. Corpos
+// pequenos são verificados na hora; uploads multipart são verificados
+// enquanto o handler lê o stream, e a leitura falha se o hash não bater.
+func bindBodyHash(r *http.Request, expected []byte) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		if sum := sha256.Sum256(nil); !bytes.Equal(sum[:], expected) {
+			return errBodyHashMismatch
+		}
+		return nil
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") && r.ContentLength >= 0 && r.ContentLength <= maxEagerBodyHash {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxEagerBodyHash+1))
+		r.Body.Close()
+		if err != nil {
+			return fmt.Errorf("ler corpo da requisição: %w", err)
+		}
+		if sum := sha256.Sum256(body); !bytes.Equal(sum[:], expected) {
+			return errBodyHashMismatch
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+
+	r.Body = &hashingBody{ReadCloser: r.Body, hash: sha256.New(), expected: expected}
+	return nil
+}
+
+// hashingBody troca o io.EOF final por errBodyHashMismatch quando o corpo
+// recebido difere do que foi assinado.
+type hashingBody struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected []byte
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(b.hash.Sum(nil), b.expected) {
+		return n, errBodyHashMismatch
+	}
+	return n, err
+}
+
+// PendingBodyHash reports whether r's body is a signed stream whose hash is
+// only known once it has been read to the end. Handlers must not forward
+// such a body to Drive before FinishBody succeeds.
+func PendingBodyHash(r *http.Request) bool {
+	_, ok := r.Body.(*hashingBody)
+	return ok
+}
+
+// FinishBody drains what is left of r's body and reports a mismatch with the
+// signed hash. It is a no-op for bodies that are not being verified.
+func FinishBody(r *http.Request) error {
+	if !PendingBodyHash(r) {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, r.Body)
+	return err
+}
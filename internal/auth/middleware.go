@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/pkg/logger"
+)
+
+const identityKey = "auth.identity"
+
+// RequireDriveToken validates the caller's Google access token before the
+// handler reads the request body: the Authorization header must be
+// "Bearer <token>", the token must pass v and carry the drive or drive.file
+// scope. The resolved identity is stored in the Gin context (see Identity).
+//
+// When applies is not nil and returns false the request is passed through,
+// e.g. for credential modes that do not forward the caller's token.
+func RequireDriveToken(v Verifier, applies func(*gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if applies != nil && !applies(c) {
+			c.Next()
+			return
+		}
+
+		token, ok := parseBearer(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="drive"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Header Authorization ausente ou malformado (esperado: Bearer <token>)"})
+			return
+		}
+
+		info, err := v.Verify(c.Request.Context(), token)
+		if errors.Is(err, ErrInvalidToken) {
+			c.Header("WWW-Authenticate", `Bearer realm="drive", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token de acesso inválido ou expirado"})
+			return
+		} else if err != nil {
+			logger.Error("validar token: " + err.Error())
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Não foi possível validar o token de acesso"})
+			return
+		}
+
+		if !info.HasAnyScope(ScopeDriveFile, ScopeDrive) {
+			c.Header("WWW-Authenticate", `Bearer realm="drive", error="insufficient_scope", scope="`+ScopeDriveFile+`"`)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "O token não possui o escopo drive.file ou drive"})
+			return
+		}
+
+		c.Set(identityKey, info)
+		c.Next()
+	}
+}
+
+// Identity returns the Google account resolved by RequireDriveToken.
+func Identity(c *gin.Context) (*TokenInfo, bool) {
+	value, ok := c.Get(identityKey)
+	if !ok {
+		return nil, false
+	}
+	info, ok := value.(*TokenInfo)
+	return info, ok
+}
+
+func parseBearer(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", false
+	}
+	return token, true
+}
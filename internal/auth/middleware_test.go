@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// stubVerifier responde a partir de um mapa de tokens e conta as chamadas.
+type stubVerifier struct {
+	mu     sync.Mutex
+	tokens map[string]*TokenInfo
+	err    error
+	calls  map[string]int
+}
+
+func newStubVerifier(tokens map[string]*TokenInfo) *stubVerifier {
+	return &stubVerifier{tokens: tokens, calls: make(map[string]int)}
+}
+
+func (s *stubVerifier) Verify(_ context.Context, token string) (*TokenInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[token]++
+	if s.err != nil {
+		return nil, s.err
+	}
+	info, ok := s.tokens[token]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return info, nil
+}
+
+func (s *stubVerifier) callCount(token string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[token]
+}
+
+func newDriveTokenEngine(v Verifier, applies func(*gin.Context) bool) *gin.Engine {
+	r := gin.New()
+	r.POST("/upload", RequireDriveToken(v, applies), func(c *gin.Context) {
+		info, ok := Identity(c)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"identity": nil})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"identity": info.Email})
+	})
+	return r
+}
+
+func postUpload(r *gin.Engine, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireDriveToken(t *testing.T) {
+	verifier := newStubVerifier(map[string]*TokenInfo{
+		"drive-file": {Subject: "1", Email: "pessoa@example.com", Scopes: []string{"openid", ScopeDriveFile}},
+		"drive":      {Subject: "2", Email: "admin@example.com", Scopes: []string{ScopeDrive}},
+		"readonly":   {Subject: "3", Email: "leitor@example.com", Scopes: []string{"https://www.googleapis.com/auth/drive.readonly"}},
+	})
+	r := newDriveTokenEngine(verifier, nil)
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		challenge     string // trecho esperado em WWW-Authenticate
+		identity      string
+	}{
+		{"sem header", "", http.StatusUnauthorized, `Bearer realm="drive"`, ""},
+		{"outro esquema", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, `Bearer realm="drive"`, ""},
+		{"Bearer sem token", "Bearer", http.StatusUnauthorized, `Bearer realm="drive"`, ""},
+		{"Bearer vazio", "Bearer   ", http.StatusUnauthorized, `Bearer realm="drive"`, ""},
+		{"token com espaço", "Bearer abc def", http.StatusUnauthorized, `Bearer realm="drive"`, ""},
+		{"token inválido", "Bearer desconhecido", http.StatusUnauthorized, `error="invalid_token"`, ""},
+		{"escopo insuficiente", "Bearer readonly", http.StatusForbidden, `error="insufficient_scope"`, ""},
+		{"escopo drive.file", "Bearer drive-file", http.StatusOK, "", "pessoa@example.com"},
+		{"escopo drive", "Bearer drive", http.StatusOK, "", "admin@example.com"},
+		{"esquema em minúsculas", "bearer drive-file", http.StatusOK, "", "pessoa@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postUpload(r, tt.authorization)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, esperado %d (%s)", w.Code, tt.status, w.Body)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.challenge != "" && !strings.Contains(challenge, tt.challenge) {
+				t.Errorf("WWW-Authenticate = %q, esperado conter %q", challenge, tt.challenge)
+			}
+			if tt.challenge == "" && challenge != "" {
+				t.Errorf("WWW-Authenticate inesperado: %q", challenge)
+			}
+			if tt.identity != "" && !strings.Contains(w.Body.String(), tt.identity) {
+				t.Errorf("identidade não repassada ao handler: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestRequireDriveTokenVerifierUnavailable(t *testing.T) {
+	verifier := newStubVerifier(nil)
+	verifier.err = errors.New("tokeninfo fora do ar")
+	r := newDriveTokenEngine(verifier, nil)
+
+	w := postUpload(r, "Bearer qualquer")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, esperado 503", w.Code)
+	}
+}
+
+func TestRequireDriveTokenSkippedWhenNotApplicable(t *testing.T) {
+	verifier := newStubVerifier(nil)
+	r := newDriveTokenEngine(verifier, func(*gin.Context) bool { return false })
+
+	w := postUpload(r, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, esperado 200", w.Code)
+	}
+	if verifier.callCount("") != 0 {
+		t.Fatal("o verificador não deveria ser chamado")
+	}
+}
+
+func TestRequireDriveTokenCachesVerifications(t *testing.T) {
+	verifier := newStubVerifier(map[string]*TokenInfo{
+		"drive-file": {Subject: "1", Email: "pessoa@example.com", Scopes: []string{ScopeDriveFile}},
+	})
+	r := newDriveTokenEngine(NewCachingVerifier(verifier, time.Minute), nil)
+
+	for range 3 {
+		if w := postUpload(r, "Bearer drive-file"); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, esperado 200", w.Code)
+		}
+	}
+	if n := verifier.callCount("drive-file"); n != 1 {
+		t.Fatalf("tokeninfo consultado %d vezes, esperado 1", n)
+	}
+
+	// Tokens rejeitados não entram no cache
+	for range 2 {
+		if w := postUpload(r, "Bearer desconhecido"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, esperado 401", w.Code)
+		}
+	}
+	if n := verifier.callCount("desconhecido"); n != 2 {
+		t.Fatalf("token inválido consultado %d vezes, esperado 2", n)
+	}
+}
+
+func TestCachingVerifierExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		expiresIn time.Duration // validade do token; zero quando desconhecida
+	}{
+		{"expira pelo TTL do cache", 50 * time.Millisecond, time.Hour},
+		{"expira junto com o token", time.Hour, 50 * time.Millisecond},
+		{"validade desconhecida usa o TTL", 50 * time.Millisecond, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &TokenInfo{Subject: "1", Scopes: []string{ScopeDriveFile}}
+			if tt.expiresIn > 0 {
+				info.ExpiresAt = time.Now().Add(tt.expiresIn)
+			}
+			verifier := newStubVerifier(map[string]*TokenInfo{"token": info})
+			cache := NewCachingVerifier(verifier, tt.ttl)
+			ctx := context.Background()
+
+			for range 2 {
+				if _, err := cache.Verify(ctx, "token"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := verifier.callCount("token"); n != 1 {
+				t.Fatalf("antes de expirar: %d consultas, esperado 1", n)
+			}
+
+			time.Sleep(80 * time.Millisecond)
+			if _, err := cache.Verify(ctx, "token"); err != nil {
+				t.Fatal(err)
+			}
+			if n := verifier.callCount("token"); n != 2 {
+				t.Fatalf("depois de expirar: %d consultas, esperado 2", n)
+			}
+		})
+	}
+}
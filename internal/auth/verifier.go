@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ScopeDrive     = "https://www.googleapis.com/auth/drive"
+	ScopeDriveFile = "https://www.googleapis.com/auth/drive.file"
+
+	defaultTokenInfoEndpoint = "https://oauth2.googleapis.com/tokeninfo"
+)
+
+// ErrInvalidToken means the token is unknown, expired or revoked.
+var ErrInvalidToken = errors.New("token inválido ou expirado")
+
+// TokenInfo is the Google account identity and grants behind an access token.
+type TokenInfo struct {
+	Subject   string    `json:"sub"`
+	Email     string    `json:"email,omitempty"`
+	Audience  string    `json:"aud,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HasAnyScope reports whether at least one of scopes was granted.
+func (t *TokenInfo) HasAnyScope(scopes ...string) bool {
+	for _, scope := range scopes {
+		if slices.Contains(t.Scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier introspects an access token. Implementations return
+// ErrInvalidToken for tokens that must be rejected with 401.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*TokenInfo, error)
+}
+
+// TokenInfoVerifier asks Google's tokeninfo endpoint about the token.
+type TokenInfoVerifier struct {
+	Client   *http.Client
+	Endpoint string
+}
+
+func NewTokenInfoVerifier() *TokenInfoVerifier {
+	return &TokenInfoVerifier{
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		Endpoint: defaultTokenInfoEndpoint,
+	}
+}
+
+type tokenInfoResponse struct {
+	Sub    string `json:"sub"`
+	Email  string `json:"email"`
+	Aud    string `json:"aud"`
+	Scope  string `json:"scope"`
+	Exp    string `json:"exp"`
+	Error  string `json:"error"`
+	ErrMsg string `json:"error_description"`
+}
+
+func (v *TokenInfoVerifier) Verify(ctx context.Context, token string) (*TokenInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.Endpoint+"?access_token="+url.QueryEscape(token), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consultar tokeninfo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// O tokeninfo responde 400 para tokens inválidos, expirados ou revogados
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrInvalidToken
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tokeninfo respondeu %s", resp.Status)
+	}
+
+	var body tokenInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decodificar tokeninfo: %w", err)
+	}
+
+	info := &TokenInfo{
+		Subject:  body.Sub,
+		Email:    body.Email,
+		Audience: body.Aud,
+		Scopes:   strings.Fields(body.Scope),
+	}
+	if exp, err := strconv.ParseInt(body.Exp, 10, 64); err == nil {
+		info.ExpiresAt = time.Unix(exp, 0)
+	}
+	if !info.ExpiresAt.IsZero() && time.Now().After(info.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	return info, nil
+}
+
+// CachingVerifier memoizes successful verifications for up to ttl, and never
+// past the token expiry, so each upload does not cost a tokeninfo round trip.
+type CachingVerifier struct {
+	next Verifier
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]cacheEntry
+}
+
+type cacheEntry struct {
+	info    *TokenInfo
+	expires time.Time
+}
+
+func NewCachingVerifier(next Verifier, ttl time.Duration) *CachingVerifier {
+	return &CachingVerifier{next: next, ttl: ttl, entries: make(map[[sha256.Size]byte]cacheEntry)}
+}
+
+func (v *CachingVerifier) Verify(ctx context.Context, token string) (*TokenInfo, error) {
+	// A chave é o hash para não manter tokens em claro na memória
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	v.mu.Lock()
+	entry, ok := v.entries[key]
+	v.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.info, nil
+	}
+
+	info, err := v.next.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := now.Add(v.ttl)
+	if !info.ExpiresAt.IsZero() && info.ExpiresAt.Before(expires) {
+		expires = info.ExpiresAt
+	}
+
+	v.mu.Lock()
+	for k, e := range v.entries {
+		if now.After(e.expires) {
+			delete(v.entries, k)
+		}
+	}
+	v.entries[key] = cacheEntry{info: info, expires: expires}
+	v.mu.Unlock()
+
+	return info, nil
+}
@@ -4,12 +4,68 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"upload-drive-script/internal/media"
 )
 
 const (
-	defaultBaseURL    = "localhost"
-	defaultServerPort = ":3000"
+	defaultBaseURL      = "localhost"
+	defaultServerPort   = ":3000"
+	defaultJobWorkers   = 2
+	defaultJobQueueSize = 100
+	defaultJobRetention = 24 * time.Hour
+
+	defaultDataDir         = "data"
+	defaultDriveChunkSize  = 10 << 20
+	defaultDriveMaxRetries = 5
+
+	defaultStorageBackend = "local"
+	defaultUploadDir      = "upload"
+
+	defaultRetentionInterval = 10 * time.Minute
+
+	defaultThumbnailAt        = time.Second
+	defaultStoryboardInterval = 10 * time.Second
+	defaultStoryboardColumns  = 10
+	defaultStoryboardWidth    = 160
+
+	defaultFFmpegTimeout      = 2 * time.Hour
+	defaultTranscodePreset    = "veryfast"
+	defaultTranscodeCRF       = 23
+	defaultTranscodeLowHeight = 480
+	defaultHLSSegmentDuration = 6 * time.Second
+
+	defaultDriveAuthMode = "access_token"
+	defaultTokenCacheTTL = 5 * time.Minute
+	defaultAPISignSkew   = 5 * time.Minute
+
+	defaultSignedURLTTL    = 24 * time.Hour
+	defaultSignedURLMaxTTL = 7 * 24 * time.Hour
+
+	defaultCORSMaxAge = 10 * time.Minute
+
+	defaultMaxFileSize          = 10 << 30
+	defaultRemoteConnectTimeout = 10 * time.Second
+	defaultRemoteHeaderTimeout  = 30 * time.Second
+	defaultRemoteIdleTimeout    = time.Minute
+
+	defaultDownloadRetries         = 3
+	defaultDownloadConnections     = 4
+	defaultDownloadParallelMinSize = 100 << 20
+	defaultDownloadPartialTTL      = 24 * time.Hour
+
+	defaultTusExpiration = 24 * time.Hour
+
+	defaultBatchMaxItems    = 100
+	defaultBatchConcurrency = 3
+
+	defaultExtractorCommand = "yt-dlp"
+	defaultExtractorFormat  = "best[ext=mp4]/best"
+	defaultExtractorTimeout = 2 * time.Minute
 )
 
 func BaseURL() string { return envOrDefault("APP_BASE_URL", defaultBaseURL) }
@@ -18,6 +74,331 @@ func ServerPort() string {
 	return envOrDefault("APP_SERVER_PORT", defaultServerPort)
 }
 
+func JobWorkers() int { return envIntOrDefault("JOB_WORKERS", defaultJobWorkers) }
+
+func JobQueueSize() int { return envIntOrDefault("JOB_QUEUE_SIZE", defaultJobQueueSize) }
+
+func JobRetention() time.Duration {
+	return envDurationOrDefault("JOB_RETENTION", defaultJobRetention)
+}
+
+// DataDir is where the service keeps state that must survive restarts.
+func DataDir() string { return envOrDefault("APP_DATA_DIR", defaultDataDir) }
+
+func DriveChunkSize() int64 {
+	return int64(envIntOrDefault("DRIVE_CHUNK_SIZE", defaultDriveChunkSize))
+}
+
+func DriveMaxRetries() int { return envIntOrDefault("DRIVE_MAX_RETRIES", defaultDriveMaxRetries) }
+
+// DriveVerifyChecksum compares Drive's md5Checksum with the received file
+// after each upload.
+func DriveVerifyChecksum() bool { return envBoolOrDefault("DRIVE_VERIFY_CHECKSUM", true) }
+
+func DriveSessionDir() string {
+	return envOrDefault("DRIVE_SESSION_DIR", filepath.Join(DataDir(), "drive-sessions"))
+}
+
+// UploadSessionDir keeps the Drive sessions handed to browsers by
+// /upload-sessions until they are completed.
+func UploadSessionDir() string {
+	return envOrDefault("UPLOAD_SESSION_DIR", filepath.Join(DataDir(), "upload-sessions"))
+}
+
+// HistoryFile is the database recording every upload, queried by GET /uploads.
+func HistoryFile() string {
+	return envOrDefault("HISTORY_FILE", filepath.Join(DataDir(), "history.db"))
+}
+
+// LegacyHistoryFile is the JSON Lines history of earlier versions, imported
+// into HistoryFile on startup when present.
+func LegacyHistoryFile() string {
+	return filepath.Join(DataDir(), "history.jsonl")
+}
+
+// DedupeIndexDir keeps the content-addressed index of processed uploads,
+// one file per SHA-256.
+func DedupeIndexDir() string {
+	return envOrDefault("DEDUPE_INDEX_DIR", filepath.Join(DataDir(), "dedupe"))
+}
+
+// StorageBackend selects where the copies served from /uploads live: "local" or "s3".
+func StorageBackend() string { return envOrDefault("STORAGE_BACKEND", defaultStorageBackend) }
+
+// UploadDir is the root of the local storage backend.
+func UploadDir() string { return envOrDefault("UPLOAD_DIR", defaultUploadDir) }
+
+// StagingDir holds files while they are being received and processed,
+// before they are handed to the storage backend.
+func StagingDir() string {
+	return envOrDefault("UPLOAD_STAGING_DIR", filepath.Join(UploadDir(), ".staging"))
+}
+
+// Limites de retenção das cópias em /uploads; zero desabilita cada limite.
+func RetentionMaxAge() time.Duration { return envDurationOrDefault("UPLOAD_RETENTION_MAX_AGE", 0) }
+
+func RetentionMaxBytes() int64 { return int64(envIntOrDefault("UPLOAD_RETENTION_MAX_BYTES", 0)) }
+
+func RetentionMaxFiles() int { return envIntOrDefault("UPLOAD_RETENTION_MAX_FILES", 0) }
+
+func RetentionInterval() time.Duration {
+	return envDurationOrDefault("UPLOAD_RETENTION_INTERVAL", defaultRetentionInterval)
+}
+
+// DefaultAudioProfile is used when the request does not send audio_profile.
+func DefaultAudioProfile() string {
+	return envOrDefault("AUDIO_DEFAULT_PROFILE", media.DefaultAudioProfileName)
+}
+
+// ThumbnailAt is the default timestamp of the poster frame when the request
+// does not send thumbnail_at.
+func ThumbnailAt() time.Duration { return envDurationOrDefault("THUMBNAIL_AT", defaultThumbnailAt) }
+
+// StoryboardInterval is the time between two frames of the storyboard sprite.
+func StoryboardInterval() time.Duration {
+	return envDurationOrDefault("STORYBOARD_INTERVAL", defaultStoryboardInterval)
+}
+
+func StoryboardColumns() int { return envIntOrDefault("STORYBOARD_COLUMNS", defaultStoryboardColumns) }
+
+// StoryboardTileWidth is the width in pixels of each storyboard frame.
+func StoryboardTileWidth() int {
+	return envIntOrDefault("STORYBOARD_TILE_WIDTH", defaultStoryboardWidth)
+}
+
+// FFmpegTimeout bounds each ffmpeg/ffprobe run, on top of the request or job context.
+func FFmpegTimeout() time.Duration {
+	return envDurationOrDefault("FFMPEG_TIMEOUT", defaultFFmpegTimeout)
+}
+
+func TranscodePreset() string { return envOrDefault("TRANSCODE_PRESET", defaultTranscodePreset) }
+
+func TranscodeCRF() int { return envIntOrDefault("TRANSCODE_CRF", defaultTranscodeCRF) }
+
+// TranscodeLowHeight is the height of the optional low-resolution rendition.
+func TranscodeLowHeight() int {
+	return envIntOrDefault("TRANSCODE_LOW_HEIGHT", defaultTranscodeLowHeight)
+}
+
+func HLSSegmentDuration() time.Duration {
+	return envDurationOrDefault("HLS_SEGMENT_DURATION", defaultHLSSegmentDuration)
+}
+
+// DriveAuthMode is the credential mode used when the request does not pick one:
+// access_token, refresh_token or service_account.
+func DriveAuthMode() string { return envOrDefault("DRIVE_AUTH_MODE", defaultDriveAuthMode) }
+
+// DriveAuthAllowedModes lists the modes a request may select through the
+// X-Drive-Auth-Mode header.
+func DriveAuthAllowedModes() []string {
+	return envListOrDefault("DRIVE_AUTH_ALLOWED_MODES", []string{"access_token", "refresh_token"})
+}
+
+func GoogleClientID() string { return envOrDefault("GOOGLE_CLIENT_ID", "") }
+
+func GoogleClientSecret() string { return envOrDefault("GOOGLE_CLIENT_SECRET", "") }
+
+// GoogleRefreshToken is only used when DRIVE_AUTH_MODE=refresh_token.
+func GoogleRefreshToken() string { return envOrDefault("GOOGLE_REFRESH_TOKEN", "") }
+
+// GoogleServiceAccountFile is the path of the service account JSON key.
+func GoogleServiceAccountFile() string { return envOrDefault("GOOGLE_SERVICE_ACCOUNT_FILE", "") }
+
+// GoogleServiceAccountSubject is the user impersonated through domain-wide
+// delegation when the request does not send X-Drive-Subject.
+func GoogleServiceAccountSubject() string {
+	return envOrDefault("GOOGLE_SERVICE_ACCOUNT_SUBJECT", "")
+}
+
+// GoogleServiceAccountAllowedSubjects lists the users a request may
+// impersonate through X-Drive-Subject. API keys with the admin scope may
+// pick any subject.
+func GoogleServiceAccountAllowedSubjects() []string {
+	return envListOrDefault("GOOGLE_SERVICE_ACCOUNT_ALLOWED_SUBJECTS", nil)
+}
+
+// AuthVerifyTokens enables checking the caller's access token and Drive
+// scopes before an upload body is read.
+func AuthVerifyTokens() bool { return envBoolOrDefault("AUTH_VERIFY_TOKENS", true) }
+
+// AuthTokenCacheTTL bounds how long a successful token verification is reused.
+func AuthTokenCacheTTL() time.Duration {
+	return envDurationOrDefault("AUTH_TOKEN_CACHE_TTL", defaultTokenCacheTTL)
+}
+
+// APIKeysFile is the JSON file with the API keys of our own callers; empty
+// disables API key authentication.
+func APIKeysFile() string { return envOrDefault("API_KEYS_FILE", "") }
+
+// APISignatureMaxSkew is how far X-Api-Timestamp may be from the server clock.
+func APISignatureMaxSkew() time.Duration {
+	return envDurationOrDefault("API_SIGNATURE_MAX_SKEW", defaultAPISignSkew)
+}
+
+// SignedURLSecret is the HMAC key for the /uploads URLs returned to clients;
+// empty leaves the URLs unsigned.
+func SignedURLSecret() string { return envOrDefault("SIGNED_URL_SECRET", "") }
+
+// SignedURLTTL is how long a signed /uploads URL stays valid.
+func SignedURLTTL() time.Duration { return envDurationOrDefault("SIGNED_URL_TTL", defaultSignedURLTTL) }
+
+// SignedURLMaxTTL caps the expiry a client may ask for when minting a URL.
+func SignedURLMaxTTL() time.Duration {
+	return envDurationOrDefault("SIGNED_URL_MAX_TTL", defaultSignedURLMaxTTL)
+}
+
+// SignedURLRequired rejects GET /uploads requests without a valid signature.
+func SignedURLRequired() bool { return envBoolOrDefault("SIGNED_URL_REQUIRED", false) }
+
+// CORSAllowedOrigins lists the browser origins accepted by the API: exact
+// origins, subdomain wildcards (https://*.example.com) or "*".
+func CORSAllowedOrigins() []string { return envListOrDefault("CORS_ALLOWED_ORIGINS", []string{"*"}) }
+
+// CORSAllowedHeaders are the request headers a preflight may ask for.
+func CORSAllowedHeaders() []string {
+	return envListOrDefault("CORS_ALLOWED_HEADERS", []string{
+		"Authorization", "Content-Type", "Accept",
+		"X-Drive-Auth-Mode", "X-Drive-Refresh-Token", "X-Drive-Subject",
+		"X-Api-Key", "X-Api-Key-Id", "X-Api-Timestamp", "X-Api-Signature", "X-Content-Sha256",
+		"X-Admin-Token",
+		"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset",
+	})
+}
+
+// CORSExposedHeaders are the response headers readable by browser scripts.
+func CORSExposedHeaders() []string {
+	return envListOrDefault("CORS_EXPOSED_HEADERS", []string{
+		"Content-Disposition",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+		"Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires", "Upload-Job-Id", "Upload-Job-Url",
+	})
+}
+
+// CORSAllowCredentials lets browsers send cookies and HTTP auth; it cannot be
+// combined with the "*" origin.
+func CORSAllowCredentials() bool { return envBoolOrDefault("CORS_ALLOW_CREDENTIALS", false) }
+
+// CORSMaxAge is how long browsers may cache a preflight response.
+func CORSMaxAge() time.Duration { return envDurationOrDefault("CORS_MAX_AGE", defaultCORSMaxAge) }
+
+// MaxFileSize caps, in bytes, both files sent to /upload and files downloaded
+// by /upload-url and /probe; 0 disables the limit.
+func MaxFileSize() int64 { return int64(envIntOrDefault("MAX_FILE_SIZE", defaultMaxFileSize)) }
+
+// RemoteConnectTimeout bounds the TCP connection and TLS handshake of downloads.
+func RemoteConnectTimeout() time.Duration {
+	return envDurationOrDefault("REMOTE_CONNECT_TIMEOUT", defaultRemoteConnectTimeout)
+}
+
+// RemoteHeaderTimeout bounds the wait for the response headers of downloads.
+func RemoteHeaderTimeout() time.Duration {
+	return envDurationOrDefault("REMOTE_HEADER_TIMEOUT", defaultRemoteHeaderTimeout)
+}
+
+// RemoteIdleTimeout aborts a download whose body stops delivering data.
+func RemoteIdleTimeout() time.Duration {
+	return envDurationOrDefault("REMOTE_IDLE_TIMEOUT", defaultRemoteIdleTimeout)
+}
+
+// DownloadDir keeps partial remote downloads so an interrupted transfer can
+// be resumed by a later request.
+func DownloadDir() string {
+	return envOrDefault("DOWNLOAD_DIR", filepath.Join(DataDir(), "downloads"))
+}
+
+// DownloadRetries is how many times a failed download is resumed within one request.
+func DownloadRetries() int { return envIntOrDefault("DOWNLOAD_RETRIES", defaultDownloadRetries) }
+
+// DownloadConnections is the number of parallel ranges used for large files.
+func DownloadConnections() int {
+	return envIntOrDefault("DOWNLOAD_CONNECTIONS", defaultDownloadConnections)
+}
+
+// DownloadParallelMinSize is the smallest file, in bytes, fetched in parallel ranges.
+func DownloadParallelMinSize() int64 {
+	return int64(envIntOrDefault("DOWNLOAD_PARALLEL_MIN_SIZE", defaultDownloadParallelMinSize))
+}
+
+// DownloadPartialTTL is how long abandoned partial downloads are kept.
+func DownloadPartialTTL() time.Duration {
+	return envDurationOrDefault("DOWNLOAD_PARTIAL_TTL", defaultDownloadPartialTTL)
+}
+
+// TusDir keeps tus uploads while they are received, so they survive a restart.
+func TusDir() string { return envOrDefault("TUS_DIR", filepath.Join(DataDir(), "tus")) }
+
+// TusExpiration is how long an unfinished tus upload is kept after its last chunk.
+func TusExpiration() time.Duration {
+	return envDurationOrDefault("TUS_EXPIRATION", defaultTusExpiration)
+}
+
+// BatchMaxItems caps how many URLs one /upload-url/batch request may carry.
+func BatchMaxItems() int { return envIntOrDefault("BATCH_MAX_ITEMS", defaultBatchMaxItems) }
+
+// BatchConcurrency is how many items of a batch are downloaded and
+// uploaded at the same time.
+func BatchConcurrency() int { return envIntOrDefault("BATCH_CONCURRENCY", defaultBatchConcurrency) }
+
+// URLExtractorEnabled turns on resolving video-site pages with an external
+// extractor. It only takes effect when URLExtractorCommand is installed.
+func URLExtractorEnabled() bool { return envBoolOrDefault("URL_EXTRACTOR_ENABLED", true) }
+
+// URLExtractorCommand is the yt-dlp compatible command used to resolve
+// video-site pages.
+func URLExtractorCommand() string {
+	return envOrDefault("URL_EXTRACTOR_COMMAND", defaultExtractorCommand)
+}
+
+// URLExtractorArgs are extra arguments passed before the ones the service adds.
+func URLExtractorArgs() []string { return envListOrDefault("URL_EXTRACTOR_ARGS", nil) }
+
+// URLExtractorFormat is the format selector; it must pick a single file
+// with both audio and video.
+func URLExtractorFormat() string {
+	return envOrDefault("URL_EXTRACTOR_FORMAT", defaultExtractorFormat)
+}
+
+// URLExtractorHosts are the hosts whose pages are handed to the extractor.
+func URLExtractorHosts() []string {
+	return envListOrDefault("URL_EXTRACTOR_HOSTS", []string{
+		"youtube.com", "*.youtube.com", "youtu.be", "vimeo.com", "*.vimeo.com",
+	})
+}
+
+// URLExtractorTimeout bounds one extractor run.
+func URLExtractorTimeout() time.Duration {
+	return envDurationOrDefault("URL_EXTRACTOR_TIMEOUT", defaultExtractorTimeout)
+}
+
+// RemoteAllowedHosts, when set, restricts /upload-url to these hosts
+// (exact names or *.example.com).
+func RemoteAllowedHosts() []string { return envListOrDefault("REMOTE_ALLOWED_HOSTS", nil) }
+
+// RemoteDeniedHosts are hosts /upload-url never fetches.
+func RemoteDeniedHosts() []string { return envListOrDefault("REMOTE_DENIED_HOSTS", nil) }
+
+// RemoteAllowedCIDRs re-enables internal ranges that are blocked by default.
+func RemoteAllowedCIDRs() []string { return envListOrDefault("REMOTE_ALLOWED_CIDRS", nil) }
+
+// RemoteDeniedCIDRs blocks extra ranges, taking precedence over the allowed ones.
+func RemoteDeniedCIDRs() []string { return envListOrDefault("REMOTE_DENIED_CIDRS", nil) }
+
+func AdminAPIToken() string { return envOrDefault("ADMIN_API_TOKEN", "") }
+
+func S3Endpoint() string { return envOrDefault("S3_ENDPOINT", "") }
+
+func S3Region() string { return envOrDefault("S3_REGION", "us-east-1") }
+
+func S3Bucket() string { return envOrDefault("S3_BUCKET", "") }
+
+func S3Prefix() string { return envOrDefault("S3_PREFIX", "") }
+
+func S3AccessKeyID() string { return envOrDefault("S3_ACCESS_KEY_ID", "") }
+
+func S3SecretAccessKey() string { return envOrDefault("S3_SECRET_ACCESS_KEY", "") }
+
+func S3PathStyle() bool { return envBoolOrDefault("S3_PATH_STYLE", true) }
+
 func envOrDefault(key, defaultValue string) string {
 	if value, ok := os.LookupEnv(key); ok && value != "" {
 		return value
@@ -25,6 +406,47 @@ func envOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+func envIntOrDefault(key string, defaultValue int) int {
+	if value, ok := lookupEnvNonEmpty(key); ok {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func envBoolOrDefault(key string, defaultValue bool) bool {
+	if value, ok := lookupEnvNonEmpty(key); ok {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func envDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value, ok := lookupEnvNonEmpty(key); ok {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func envListOrDefault(key string, defaultValue []string) []string {
+	value, ok := lookupEnvNonEmpty(key)
+	if !ok {
+		return defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func PublicBaseURL() (*url.URL, bool) {
 	raw, ok := lookupEnvNonEmpty("APP_BASE_URL")
 	if !ok {
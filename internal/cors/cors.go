@@ -0,0 +1,232 @@
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config describes which cross-origin callers are accepted.
+//
+// AllowedOrigins entries are exact origins ("https://app.example.com"),
+// subdomain wildcards ("https://*.example.com") or "*" for any origin.
+type Config struct {
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// Policy answers preflights and decorates responses according to a Config.
+// The methods advertised for each path come from the registered routes (see
+// SetRoutes), so preflights never offer methods the server does not handle.
+type Policy struct {
+	cfg       Config
+	anyOrigin bool
+	exact     map[string]bool
+	wildcards []wildcardOrigin
+
+	mu     sync.RWMutex
+	routes []route
+}
+
+type wildcardOrigin struct {
+	prefix string // esquema + "://"
+	suffix string // ".example.com[:porta]"
+}
+
+type route struct {
+	segments []string
+	methods  []string
+}
+
+func New(cfg Config) (*Policy, error) {
+	p := &Policy{cfg: cfg, exact: make(map[string]bool)}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		switch {
+		case origin == "":
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://*")
+			p.wildcards = append(p.wildcards, wildcardOrigin{prefix: scheme + "://", suffix: host})
+		case strings.Contains(origin, "*"):
+			return nil, errors.New("origem CORS inválida (o curinga só é aceito como subdomínio, ex.: https://*.exemplo.com): " + origin)
+		default:
+			p.exact[origin] = true
+		}
+	}
+
+	// Com credenciais o navegador recusa "*", e refletir qualquer origem anularia a política
+	if p.anyOrigin && cfg.AllowCredentials {
+		return nil, errors.New("CORS: credenciais não podem ser combinadas com a origem *")
+	}
+	return p, nil
+}
+
+// SetRoutes records the method allowed on each registered path. Call it
+// after every route has been added to the engine.
+func (p *Policy) SetRoutes(routes gin.RoutesInfo) {
+	byPath := make(map[string]*route)
+	var ordered []*route
+	for _, r := range routes {
+		entry, ok := byPath[r.Path]
+		if !ok {
+			entry = &route{segments: splitPath(r.Path)}
+			byPath[r.Path] = entry
+			ordered = append(ordered, entry)
+		}
+		if !slices.Contains(entry.methods, r.Method) {
+			entry.methods = append(entry.methods, r.Method)
+		}
+	}
+
+	compiled := make([]route, 0, len(ordered))
+	for _, entry := range ordered {
+		compiled = append(compiled, *entry)
+	}
+
+	p.mu.Lock()
+	p.routes = compiled
+	p.mu.Unlock()
+}
+
+// Middleware applies the policy. It must be installed with Engine.Use so it
+// also runs for preflights, which have no route of their own.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	allowedHeaders := strings.Join(p.cfg.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(p.cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(p.cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		headers := c.Writer.Header()
+		// A resposta depende da origem sempre que ela é refletida, inclusive quando está ausente
+		if !p.anyOrigin {
+			headers.Add("Vary", "Origin")
+		}
+
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		if !p.allowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Origem não permitida"})
+				return
+			}
+			// Sem os headers CORS o navegador bloqueia a leitura da resposta
+			c.Next()
+			return
+		}
+
+		if p.anyOrigin {
+			headers.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			headers.Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.cfg.AllowCredentials {
+			headers.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposedHeaders != "" {
+				headers.Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		methods := p.methodsFor(c.Request.URL.Path)
+		if len(methods) == 0 {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Rota não encontrada"})
+			return
+		}
+
+		headers.Add("Vary", "Access-Control-Request-Method")
+		headers.Add("Vary", "Access-Control-Request-Headers")
+		headers.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if allowedHeaders != "" {
+			headers.Set("Access-Control-Allow-Headers", allowedHeaders)
+		}
+		if p.cfg.MaxAge > 0 {
+			headers.Set("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func (p *Policy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if !strings.HasPrefix(origin, w.prefix) || !strings.HasSuffix(origin, w.suffix) {
+			continue
+		}
+		// Exige ao menos um rótulo antes do domínio: *.exemplo.com não cobre exemplo.com
+		sub := strings.TrimSuffix(strings.TrimPrefix(origin, w.prefix), w.suffix)
+		if sub != "" && !strings.ContainsAny(sub, ":/@") {
+			return true
+		}
+	}
+	return false
+}
+
+// methodsFor junta os métodos de todas as rotas que casam com path.
+func (p *Policy) methodsFor(path string) []string {
+	segments := splitPath(path)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var methods []string
+	for _, r := range p.routes {
+		if !matchSegments(r.segments, segments) {
+			continue
+		}
+		for _, method := range r.methods {
+			if !slices.Contains(methods, method) {
+				methods = append(methods, method)
+			}
+		}
+	}
+	return methods
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// matchSegments compara um caminho com o padrão de rota do Gin (:param e *curinga).
+func matchSegments(pattern, path []string) bool {
+	for i, segment := range pattern {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		if !strings.HasPrefix(segment, ":") && segment != path[i] {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") && path[i] == "" {
+			return false
+		}
+	}
+	return len(pattern) == len(path)
+}
@@ -0,0 +1,233 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newEngine monta um servidor com a política e algumas rotas parecidas com as do serviço.
+func newEngine(t *testing.T, cfg Config) *gin.Engine {
+	t.Helper()
+	policy, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(policy.Middleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/upload", ok)
+	r.HEAD("/tus/:id", ok)
+	r.PATCH("/tus/:id", ok)
+	r.DELETE("/tus/:id", ok)
+	r.GET("/uploads/:filename", ok)
+	r.DELETE("/uploads/:filename", ok)
+	r.GET("/streams/:id/*file", ok)
+	policy.SetRoutes(r.Routes())
+	return r
+}
+
+func serve(r *gin.Engine, method, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func preflight(r *gin.Engine, path, origin, method string) *httptest.ResponseRecorder {
+	return serve(r, http.MethodOptions, path, map[string]string{
+		"Origin":                        origin,
+		"Access-Control-Request-Method": method,
+	})
+}
+
+func TestOrigins(t *testing.T) {
+	r := newEngine(t, Config{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.partner.com/"},
+		ExposedHeaders: []string{"Upload-Offset"},
+	})
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://other.example.com", false},
+		{"https://cdn.partner.com", true},
+		{"https://a.b.partner.com", true},
+		{"https://partner.com", false},
+		{"http://cdn.partner.com", false},
+		{"https://evilpartner.com", false},
+		{"https://evil.com/.partner.com", false},
+		{"https://user@x.partner.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/upload", map[string]string{"Origin": tt.origin})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d; requisições simples seguem para o handler", w.Code)
+			}
+			got := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.allowed && got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, esperado %q", got, tt.origin)
+			}
+			if !tt.allowed && got != "" {
+				t.Errorf("origem negada recebeu Access-Control-Allow-Origin = %q", got)
+			}
+			if tt.allowed && w.Header().Get("Access-Control-Expose-Headers") != "Upload-Offset" {
+				t.Errorf("Access-Control-Expose-Headers = %q", w.Header().Get("Access-Control-Expose-Headers"))
+			}
+
+			w = preflight(r, "/upload", tt.origin, http.MethodPost)
+			if tt.allowed && w.Code != http.StatusNoContent {
+				t.Errorf("preflight permitido: status = %d, esperado 204", w.Code)
+			}
+			if !tt.allowed && w.Code != http.StatusForbidden {
+				t.Errorf("preflight negado: status = %d, esperado 403", w.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidWildcard(t *testing.T) {
+	for _, origin := range []string{"https://app.*.com", "https://*example.com", "*.example.com"} {
+		if _, err := New(Config{AllowedOrigins: []string{origin}}); err == nil {
+			t.Errorf("New aceitou a origem %q", origin)
+		}
+	}
+}
+
+func TestPreflightMethodsFromRoutes(t *testing.T) {
+	r := newEngine(t, Config{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedHeaders: []string{"Authorization", "Tus-Resumable"},
+		MaxAge:         10 * time.Minute,
+	})
+	const origin = "https://app.example.com"
+
+	tests := []struct {
+		path    string
+		methods []string // nil: nenhuma rota
+	}{
+		{"/upload", []string{"POST"}},
+		{"/tus/abc", []string{"HEAD", "PATCH", "DELETE"}},
+		{"/uploads/video.mp4", []string{"GET", "DELETE"}},
+		{"/streams/0123/index.m3u8", []string{"GET"}},
+		{"/streams/0123/sub/segment.ts", []string{"GET"}},
+		{"/tus", nil},
+		{"/tus/abc/extra", nil},
+		{"/desconhecida", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := preflight(r, tt.path, origin, http.MethodPost)
+			if tt.methods == nil {
+				if w.Code != http.StatusNotFound {
+					t.Fatalf("status = %d, esperado 404", w.Code)
+				}
+				return
+			}
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("status = %d, esperado 204", w.Code)
+			}
+
+			// A ordem segue a árvore de rotas do Gin, não a ordem de registro
+			got := strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", ")
+			slices.Sort(got)
+			want := slices.Sorted(slices.Values(tt.methods))
+			if !slices.Equal(got, want) {
+				t.Errorf("Access-Control-Allow-Methods = %v, esperado %v", got, want)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Authorization, Tus-Resumable" {
+				t.Errorf("Access-Control-Allow-Headers = %q", got)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("Access-Control-Max-Age = %q", got)
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	if _, err := New(Config{AllowedOrigins: []string{"*"}, AllowCredentials: true}); err == nil {
+		t.Fatal("New aceitou credenciais com a origem *")
+	}
+
+	r := newEngine(t, Config{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true})
+	w := serve(r, http.MethodPost, "/upload", map[string]string{"Origin": "https://app.example.com"})
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("com credenciais a origem deve ser refletida, veio %q", got)
+	}
+
+	w = serve(r, http.MethodPost, "/upload", map[string]string{"Origin": "https://other.example.com"})
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("origem negada recebeu Access-Control-Allow-Credentials = %q", got)
+	}
+}
+
+func TestAnyOrigin(t *testing.T) {
+	r := newEngine(t, Config{AllowedOrigins: []string{"*"}})
+
+	w := serve(r, http.MethodPost, "/upload", map[string]string{"Origin": "https://qualquer.example"})
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, esperado *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q sem AllowCredentials", got)
+	}
+	// Com "*" a resposta não depende da origem
+	if slices.Contains(w.Header().Values("Vary"), "Origin") {
+		t.Errorf("Vary = %v, não deveria incluir Origin", w.Header().Values("Vary"))
+	}
+}
+
+func TestVaryOrigin(t *testing.T) {
+	r := newEngine(t, Config{AllowedOrigins: []string{"https://app.example.com"}})
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		vary   []string
+	}{
+		{"sem Origin", http.MethodPost, nil, []string{"Origin"}},
+		{"origem permitida", http.MethodPost, map[string]string{"Origin": "https://app.example.com"}, []string{"Origin"}},
+		{"origem negada", http.MethodPost, map[string]string{"Origin": "https://evil.example"}, []string{"Origin"}},
+		{
+			"preflight",
+			http.MethodOptions,
+			map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			[]string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, "/upload", tt.header)
+			if got := w.Header().Values("Vary"); !slices.Equal(got, tt.vary) {
+				t.Errorf("Vary = %v, esperado %v", got, tt.vary)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package dedupe keeps a content-addressed index of processed uploads: one
+// JSON file per Drive account and SHA-256, pointing at the Drive files and
+// local copies that the first upload of that content produced.
+package dedupe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Entry is what the index remembers about one content hash.
+type Entry struct {
+	// Account is the Drive account that uploaded the file (see
+	// services.CredentialProvider.Account); entries are never shared across accounts.
+	Account  string `json:"account"`
+	SHA256   string `json:"sha256"`
+	MD5      string `json:"md5"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type"`
+	// FolderID is the Drive folder of the upload; entries are only reused
+	// for requests targeting the same folder.
+	FolderID string `json:"folder_id,omitempty"`
+	// DriveFileID is the uploaded file itself; AudioFileID is the extracted
+	// audio of a video, empty for audio uploads.
+	DriveFileID string `json:"drive_file_id"`
+	AudioFileID string `json:"audio_file_id,omitempty"`
+	// StoredName and AudioStoredName are the local copies served from
+	// /uploads; retention may have removed them since.
+	StoredName      string          `json:"stored_name,omitempty"`
+	AudioStoredName string          `json:"audio_stored_name,omitempty"`
+	Metadata        json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// Index stores entries in a directory. Concurrent writers of the same hash
+// are fine: the last one wins and readers never see a partial file.
+type Index struct {
+	dir string
+}
+
+func NewIndex(dir string) (*Index, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Index{dir: dir}, nil
+}
+
+// Get returns the entry account recorded for sha256, if any.
+func (ix *Index) Get(account, sha256 string) (Entry, bool) {
+	if account == "" || !sha256Pattern.MatchString(sha256) {
+		return Entry{}, false
+	}
+	data, err := os.ReadFile(ix.path(account, sha256))
+	if err != nil {
+		return Entry{}, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.DriveFileID == "" || entry.Account != account {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Put records entry, replacing any previous one for the same account and hash.
+func (ix *Index) Put(entry Entry) error {
+	if entry.Account == "" {
+		return errors.New("conta do Drive desconhecida")
+	}
+	if !sha256Pattern.MatchString(entry.SHA256) {
+		return fmt.Errorf("hash SHA-256 inválido: %q", entry.SHA256)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(ix.path(entry.Account, entry.SHA256))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// Grava em um temporário e renomeia, para que Get nunca leia um JSON pela metade
+	tmp, err := os.CreateTemp(dir, entry.SHA256+".json-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), ix.path(entry.Account, entry.SHA256))
+}
+
+// Remove forgets what account recorded for sha256, e.g. when its Drive file
+// no longer exists.
+func (ix *Index) Remove(account, sha256 string) error {
+	if account == "" || !sha256Pattern.MatchString(sha256) {
+		return nil
+	}
+	err := os.Remove(ix.path(account, sha256))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// path separa as entradas por conta. O nome do diretório é um hash, pois a
+// conta pode conter caracteres inválidos em caminhos.
+func (ix *Index) path(account, sha256Hex string) string {
+	sum := sha256.Sum256([]byte(account))
+	return filepath.Join(ix.dir, hex.EncodeToString(sum[:16]), sha256Hex+".json")
+}
@@ -0,0 +1,567 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"upload-drive-script/internal/safefetch"
+)
+
+// ErrTooLarge is returned when the remote file exceeds Downloader.MaxSize.
+var ErrTooLarge = errors.New("arquivo excede o tamanho máximo permitido")
+
+var errChanged = errors.New("o arquivo mudou na origem durante o download")
+
+// StatusError is an unexpected HTTP status from the origin.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("origem respondeu HTTP %d", e.Code)
+}
+
+// Downloader fetches remote files into Dir, resuming interrupted downloads
+// with Range requests. Partial data is kept as <key>.part next to a <key>.json
+// state file, so a later request for the same URL continues where the
+// previous one stopped as long as the origin's ETag or Last-Modified did not
+// change. Large files from origins that accept ranges are fetched over
+// several connections.
+type Downloader struct {
+	Client *http.Client
+	Dir    string
+	// MaxSize caps the file size in bytes; 0 disables the limit.
+	MaxSize int64
+	// Retries is how many times a failed transfer is resumed within one call.
+	Retries int
+	// Connections is the number of parallel ranges for files of at least
+	// ParallelMinSize bytes; 1 disables parallel downloads.
+	Connections     int
+	ParallelMinSize int64
+	// PartialTTL is how long abandoned partial files are kept.
+	PartialTTL time.Duration
+
+	locksMu sync.Mutex
+	locks   map[string]*keyLock
+}
+
+// keyLock serializa downloads da mesma URL; refs permite descartar a entrada
+// quando ninguém mais a usa.
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Request identifies the remote file.
+type Request struct {
+	URL    *url.URL
+	Header http.Header
+}
+
+// File is a completed download. The caller owns Path and must move or remove it.
+// FinalURL is the URL after redirects, or the requested one when no request
+// was needed because every chunk was already on disk.
+type File struct {
+	Path     string
+	Size     int64
+	Header   http.Header
+	FinalURL *url.URL
+}
+
+// state é persistido em <chave>.json para retomar o download em outra requisição.
+type state struct {
+	URL          string  `json:"url"`
+	ETag         string  `json:"etag,omitempty"`
+	LastModified string  `json:"last_modified,omitempty"`
+	Size         int64   `json:"size"`
+	Chunks       []chunk `json:"chunks,omitempty"`
+}
+
+// chunk é uma faixa [Start, End] baixada em paralelo; Done conta os bytes já gravados.
+type chunk struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+// validator devolve o valor para If-Range: ETag forte ou, na falta dela, Last-Modified.
+func (s *state) validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+func (s *state) reset() {
+	s.ETag, s.LastModified, s.Size, s.Chunks = "", "", -1, nil
+}
+
+func (d *Downloader) Fetch(ctx context.Context, req Request) (*File, error) {
+	if err := os.MkdirAll(d.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	d.sweep()
+
+	sum := sha256.Sum256([]byte(req.URL.String()))
+	key := hex.EncodeToString(sum[:])
+	unlock := d.lock(key)
+	defer unlock()
+
+	partPath := filepath.Join(d.Dir, key+".part")
+	statePath := filepath.Join(d.Dir, key+".json")
+
+	st := loadState(statePath, req.URL.String())
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		st = &state{URL: req.URL.String(), Size: -1}
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	var file *File
+	if len(st.Chunks) > 0 {
+		file, err = d.fetchParallel(ctx, req, f, st, nil)
+	} else {
+		file, err = d.fetchSequential(ctx, req, f, st)
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		var statusErr *StatusError
+		if errors.Is(err, ErrTooLarge) || errors.Is(err, errChanged) || errors.As(err, &statusErr) || st.validator() == "" {
+			// Sem validador não há como garantir que a próxima tentativa continue o mesmo arquivo
+			_ = os.Remove(partPath)
+			_ = os.Remove(statePath)
+		} else {
+			saveState(statePath, st)
+		}
+		return nil, err
+	}
+
+	_ = os.Remove(statePath)
+	// Renomeia ainda sob o lock para que outra requisição da mesma URL não reabra o arquivo
+	done, err := os.CreateTemp(d.Dir, key+"-*.done")
+	if err != nil {
+		_ = os.Remove(partPath)
+		return nil, err
+	}
+	done.Close()
+	if err := os.Rename(partPath, done.Name()); err != nil {
+		_ = os.Remove(partPath)
+		_ = os.Remove(done.Name())
+		return nil, err
+	}
+	file.Path = done.Name()
+	return file, nil
+}
+
+func (d *Downloader) fetchSequential(ctx context.Context, req Request, f *os.File, st *state) (*File, error) {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= d.Retries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, time.Duration(attempt)*time.Second); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := d.get(ctx, req, offset, -1, st)
+		if err != nil {
+			if !retryable(ctx, err) {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			start, _, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+			if !ok || start != offset || (st.Size >= 0 && offset > 0 && total != st.Size) {
+				resp.Body.Close()
+				lastErr = errChanged
+				offset, st.Size = 0, -1
+				if err := f.Truncate(0); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if offset == 0 {
+				recordValidators(st, resp)
+			}
+			st.Size = total
+		case http.StatusOK:
+			// A origem ignorou o Range ou o validador mudou: recomeça do zero
+			if offset > 0 {
+				offset = 0
+				if err := f.Truncate(0); err != nil {
+					resp.Body.Close()
+					return nil, err
+				}
+			}
+			recordValidators(st, resp)
+			st.Size = resp.ContentLength
+		case http.StatusRequestedRangeNotSatisfiable:
+			resp.Body.Close()
+			if offset > 0 && offset == st.Size {
+				return &File{Size: offset, Header: resp.Header, FinalURL: resp.Request.URL}, nil
+			}
+			return nil, &StatusError{resp.StatusCode}
+		default:
+			resp.Body.Close()
+			lastErr = &StatusError{resp.StatusCode}
+			if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+				continue
+			}
+			return nil, lastErr
+		}
+
+		if d.MaxSize > 0 && st.Size > d.MaxSize {
+			resp.Body.Close()
+			return nil, ErrTooLarge
+		}
+
+		if offset == 0 && d.parallelEligible(resp, st) {
+			resp.Body.Close()
+			return d.fetchParallel(ctx, req, f, st, resp)
+		}
+
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		n, err := io.Copy(f, d.limit(resp.Body, offset))
+		resp.Body.Close()
+		offset += n
+
+		if err == nil && st.Size >= 0 && offset != st.Size {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return &File{Size: offset, Header: resp.Header, FinalURL: resp.Request.URL}, nil
+		}
+		if !retryable(ctx, err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// parallelEligible exige suporte a Range (resposta 206), tamanho conhecido e
+// um validador, para que todas as conexões leiam a mesma versão do arquivo.
+func (d *Downloader) parallelEligible(resp *http.Response, st *state) bool {
+	return d.Connections > 1 && resp.StatusCode == http.StatusPartialContent &&
+		st.Size >= d.ParallelMinSize && st.Size > 0 && st.validator() != ""
+}
+
+// fetchParallel baixa as faixas de st.Chunks ao mesmo tempo. first é a
+// resposta que revelou o suporte a Range, usada apenas pelos headers.
+func (d *Downloader) fetchParallel(ctx context.Context, req Request, f *os.File, st *state, first *http.Response) (*File, error) {
+	if len(st.Chunks) == 0 {
+		if err := f.Truncate(st.Size); err != nil {
+			return nil, err
+		}
+		st.Chunks = splitChunks(st.Size, d.Connections)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		header   http.Header
+		finalURL *url.URL
+	)
+	if first != nil {
+		header, finalURL = first.Header, first.Request.URL
+	}
+
+	for i := range st.Chunks {
+		wg.Add(1)
+		go func(c *chunk) {
+			defer wg.Done()
+			resp, err := d.fetchChunk(ctx, req, f, st, c)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+			if resp != nil && header == nil {
+				header, finalURL = resp.Header, resp.Request.URL
+			}
+		}(&st.Chunks[i])
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	if finalURL == nil {
+		// Todos os trechos já estavam completos no parcial retomado
+		finalURL = req.URL
+	}
+	return &File{Size: st.Size, Header: header, FinalURL: finalURL}, nil
+}
+
+func (d *Downloader) fetchChunk(ctx context.Context, req Request, f *os.File, st *state, c *chunk) (*http.Response, error) {
+	var lastErr error
+	var lastResp *http.Response
+	for attempt := 0; attempt <= d.Retries; attempt++ {
+		start := c.Start + c.Done
+		if start > c.End {
+			return lastResp, nil
+		}
+		if attempt > 0 {
+			if err := sleep(ctx, time.Duration(attempt)*time.Second); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := d.get(ctx, req, start, c.End, st)
+		if err != nil {
+			if !retryable(ctx, err) {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil, errChanged
+			}
+			lastErr = &StatusError{resp.StatusCode}
+			if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+				continue
+			}
+			return nil, lastErr
+		}
+		if rangeStart, _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || rangeStart != start || total != st.Size {
+			resp.Body.Close()
+			return nil, errChanged
+		}
+
+		lastResp = resp
+		n, err := io.Copy(io.NewOffsetWriter(f, start), io.LimitReader(resp.Body, c.End-start+1))
+		resp.Body.Close()
+		c.Done += n
+		if err == nil && c.Start+c.Done <= c.End {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return resp, nil
+		}
+		if !retryable(ctx, err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// get pede os bytes [start, end] (end < 0 = até o fim). Retomadas levam
+// If-Range, fazendo a origem responder 200 com o arquivo inteiro se ele mudou.
+func (d *Downloader) get(ctx context.Context, req Request, start, end int64, st *state) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, req.URL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.Header {
+		httpReq.Header[key] = values
+	}
+
+	// Pedir "bytes=0-" também evita compressão transparente, cujos offsets não servem para retomar
+	rangeHeader := "bytes=" + strconv.FormatInt(start, 10) + "-"
+	if end >= 0 {
+		rangeHeader += strconv.FormatInt(end, 10)
+	}
+	httpReq.Header.Set("Range", rangeHeader)
+	if validator := st.validator(); validator != "" && (start > 0 || end >= 0) {
+		httpReq.Header.Set("If-Range", validator)
+	}
+	return d.Client.Do(httpReq)
+}
+
+// limit corta a cópia ao passar de MaxSize, considerando o que já foi baixado.
+func (d *Downloader) limit(r io.Reader, offset int64) io.Reader {
+	if d.MaxSize <= 0 {
+		return r
+	}
+	return &maxSizeReader{r: r, remaining: d.MaxSize - offset}
+}
+
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+	n, err := m.r.Read(p)
+	if int64(n) <= m.remaining {
+		m.remaining -= int64(n)
+		return n, err
+	}
+	n = int(m.remaining)
+	m.remaining = -1
+	return n, ErrTooLarge
+}
+
+func (d *Downloader) lock(key string) func() {
+	d.locksMu.Lock()
+	if d.locks == nil {
+		d.locks = make(map[string]*keyLock)
+	}
+	l, ok := d.locks[key]
+	if !ok {
+		l = &keyLock{}
+		d.locks[key] = l
+	}
+	l.refs++
+	d.locksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		d.locksMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(d.locks, key)
+		}
+		d.locksMu.Unlock()
+	}
+}
+
+// sweep remove downloads parciais abandonados há mais de PartialTTL.
+func (d *Downloader) sweep() {
+	if d.PartialTTL <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-d.PartialTTL)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && info.Mode().IsRegular() && info.ModTime().Before(cutoff) {
+			_ = os.Remove(filepath.Join(d.Dir, entry.Name()))
+		}
+	}
+}
+
+func loadState(path, rawURL string) *state {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil || st.URL != rawURL || st.validator() == "" {
+		return nil
+	}
+	return &st
+}
+
+func saveState(path string, st *state) {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0o644)
+}
+
+func recordValidators(st *state, resp *http.Response) {
+	st.reset()
+	st.ETag = resp.Header.Get("ETag")
+	st.LastModified = resp.Header.Get("Last-Modified")
+}
+
+func retryable(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.Is(err, ErrTooLarge) && !errors.Is(err, safefetch.ErrBlocked)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func splitChunks(size int64, parts int) []chunk {
+	chunkSize := (size + int64(parts) - 1) / int64(parts)
+	var chunks []chunk
+	for start := int64(0); start < size; start += chunkSize {
+		chunks = append(chunks, chunk{Start: start, End: min(start+chunkSize, size) - 1})
+	}
+	return chunks
+}
+
+// parseContentRange lê "bytes início-fim/total"; total é -1 quando "*".
+func parseContentRange(value string) (start, end, total int64, ok bool) {
+	spec, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+	rangePart, totalPart, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, 0, false
+	}
+	startPart, endPart, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, 0, false
+	}
+	var err error
+	if start, err = strconv.ParseInt(startPart, 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if end, err = strconv.ParseInt(endPart, 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	total = -1
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return 0, 0, 0, false
+		}
+	}
+	return start, end, total, true
+}
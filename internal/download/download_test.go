@@ -0,0 +1,350 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// origin é um servidor com suporte a Range e If-Range (via http.ServeContent)
+// que pode interromper respostas no meio e registra os headers recebidos.
+type origin struct {
+	mu      sync.Mutex
+	content []byte
+	etag    string
+	// abort interrompe a próxima resposta ao Range indicado ("" = qualquer)
+	// depois de enviar n bytes do corpo.
+	abort map[string]int
+	// override, quando definido, responde no lugar de ServeContent.
+	override func(w http.ResponseWriter, r *http.Request) bool
+	ranges   []string
+}
+
+func newOrigin(t *testing.T, content []byte) (*origin, *httptest.Server) {
+	t.Helper()
+	o := &origin{content: content, etag: `"v1"`, abort: make(map[string]int)}
+	srv := httptest.NewServer(o)
+	t.Cleanup(srv.Close)
+	return o, srv
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	rangeHeader := r.Header.Get("Range")
+	o.ranges = append(o.ranges, rangeHeader+" if-range="+r.Header.Get("If-Range"))
+	content, etag, override := o.content, o.etag, o.override
+	limit, abort := o.abort[rangeHeader]
+	if !abort {
+		limit, abort = o.abort[""]
+		delete(o.abort, "")
+	} else {
+		delete(o.abort, rangeHeader)
+	}
+	o.mu.Unlock()
+
+	if override != nil && override(w, r) {
+		return
+	}
+	if abort {
+		w = &abortingWriter{ResponseWriter: w, remaining: limit}
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(content))
+}
+
+func (o *origin) set(content []byte, etag string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.content, o.etag = content, etag
+}
+
+func (o *origin) abortAfter(rangeHeader string, n int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.abort[rangeHeader] = n
+}
+
+func (o *origin) requests() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	requests := o.ranges
+	o.ranges = nil
+	return requests
+}
+
+// abortingWriter corta a conexão depois de remaining bytes do corpo.
+type abortingWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+func (w *abortingWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.remaining {
+		w.remaining -= len(p)
+		return w.ResponseWriter.Write(p)
+	}
+	_, _ = w.ResponseWriter.Write(p[:w.remaining])
+	w.ResponseWriter.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func newDownloader(t *testing.T, srv *httptest.Server) *Downloader {
+	t.Helper()
+	return &Downloader{Client: srv.Client(), Dir: t.TempDir(), Connections: 1}
+}
+
+func fetch(t *testing.T, d *Downloader, rawURL string) (*File, error) {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.Fetch(context.Background(), Request{URL: u})
+}
+
+func assertContent(t *testing.T, file *File, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(file.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("conteúdo baixado difere: %d bytes, esperado %d", len(got), len(want))
+	}
+	if file.Size != int64(len(want)) {
+		t.Fatalf("Size = %d, esperado %d", file.Size, len(want))
+	}
+}
+
+// partialPaths devolve os caminhos do parcial e do estado de rawURL.
+func partialPaths(d *Downloader, rawURL string) (string, string) {
+	sum := sha256.Sum256([]byte(rawURL))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(d.Dir, key+".part"), filepath.Join(d.Dir, key+".json")
+}
+
+func assertNoPartial(t *testing.T, d *Downloader, rawURL string) {
+	t.Helper()
+	partPath, statePath := partialPaths(d, rawURL)
+	for _, p := range []string{partPath, statePath} {
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s deveria ter sido removido (err = %v)", filepath.Base(p), err)
+		}
+	}
+}
+
+func TestFetchResumesAcrossCalls(t *testing.T) {
+	content := testContent(4000)
+	o, srv := newOrigin(t, content)
+	d := newDownloader(t, srv)
+	rawURL := srv.URL + "/video.mp4"
+
+	o.abortAfter("bytes=0-", 1500)
+	if _, err := fetch(t, d, rawURL); err == nil {
+		t.Fatal("a primeira tentativa deveria falhar com a conexão interrompida")
+	}
+	partPath, _ := partialPaths(d, rawURL)
+	info, err := os.Stat(partPath)
+	if err != nil || info.Size() == 0 {
+		t.Fatalf("parcial não foi mantido: %v", err)
+	}
+	o.requests()
+
+	file, err := fetch(t, d, rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, file, content)
+
+	want := []string{fmt.Sprintf("bytes=%d- if-range=\"v1\"", info.Size())}
+	if got := o.requests(); !slices.Equal(got, want) {
+		t.Errorf("requisições da retomada = %q, esperado %q", got, want)
+	}
+	assertNoPartial(t, d, rawURL)
+}
+
+func TestFetchRestartsWhenIfRangeFails(t *testing.T) {
+	content := testContent(4000)
+	o, srv := newOrigin(t, content)
+	d := newDownloader(t, srv)
+	rawURL := srv.URL + "/video.mp4"
+
+	o.abortAfter("bytes=0-", 1500)
+	if _, err := fetch(t, d, rawURL); err == nil {
+		t.Fatal("a primeira tentativa deveria falhar")
+	}
+
+	// O arquivo muda na origem: If-Range não confere e a resposta é 200 com tudo
+	changed := bytes.Repeat([]byte("novo"), 900)
+	o.set(changed, `"v2"`)
+	file, err := fetch(t, d, rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, file, changed)
+}
+
+func TestFetchContentRangeMismatch(t *testing.T) {
+	content := testContent(4000)
+	o, srv := newOrigin(t, content)
+	d := newDownloader(t, srv)
+	rawURL := srv.URL + "/video.mp4"
+
+	o.abortAfter("bytes=0-", 1500)
+	if _, err := fetch(t, d, rawURL); err == nil {
+		t.Fatal("a primeira tentativa deveria falhar")
+	}
+
+	// A retomada recebe uma faixa que não começa no offset pedido
+	o.override = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Range") == "bytes=0-" {
+			return false
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content)
+		return true
+	}
+	if _, err := fetch(t, d, rawURL); !errors.Is(err, errChanged) {
+		t.Fatalf("err = %v, esperado errChanged", err)
+	}
+	assertNoPartial(t, d, rawURL)
+
+	// Sem parcial, o próximo pedido baixa do zero
+	o.requests()
+	file, err := fetch(t, d, rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, file, content)
+	if got := o.requests(); !slices.Equal(got, []string{"bytes=0- if-range="}) {
+		t.Errorf("requisições = %q, esperado um download do zero", got)
+	}
+}
+
+func TestFetchCompletedPartialGets416(t *testing.T) {
+	content := testContent(4000)
+	o, srv := newOrigin(t, content)
+	d := newDownloader(t, srv)
+	rawURL := srv.URL + "/video.mp4"
+
+	// O parcial já tem o arquivo inteiro, mas o download não chegou a ser concluído
+	partPath, statePath := partialPaths(d, rawURL)
+	if err := os.WriteFile(partPath, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saveState(statePath, &state{URL: rawURL, ETag: `"v1"`, Size: int64(len(content))})
+
+	file, err := fetch(t, d, rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, file, content)
+	want := []string{fmt.Sprintf("bytes=%d- if-range=\"v1\"", len(content))}
+	if got := o.requests(); !slices.Equal(got, want) {
+		t.Errorf("requisições = %q, esperado %q", got, want)
+	}
+}
+
+func TestFetchParallelResumesChunks(t *testing.T) {
+	content := testContent(4000)
+	o, srv := newOrigin(t, content)
+	d := newDownloader(t, srv)
+	d.Connections, d.ParallelMinSize = 2, 1
+	rawURL := srv.URL + "/video.mp4"
+
+	o.abortAfter("bytes=2000-3999", 700)
+	if _, err := fetch(t, d, rawURL); err == nil {
+		t.Fatal("a primeira tentativa deveria falhar com o trecho interrompido")
+	}
+	o.requests()
+
+	_, statePath := partialPaths(d, rawURL)
+	st := loadState(statePath, rawURL)
+	if st == nil || len(st.Chunks) != 2 {
+		t.Fatalf("estado dos trechos não foi salvo: %+v", st)
+	}
+
+	file, err := fetch(t, d, rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, file, content)
+
+	// Cada trecho incompleto continua de onde parou; os completos não são pedidos de novo
+	var want []string
+	for _, c := range st.Chunks {
+		if c.Start+c.Done <= c.End {
+			want = append(want, fmt.Sprintf("bytes=%d-%d if-range=\"v1\"", c.Start+c.Done, c.End))
+		}
+	}
+	got := o.requests()
+	slices.Sort(got)
+	slices.Sort(want)
+	if len(want) == 0 || !slices.Equal(got, want) {
+		t.Errorf("requisições da retomada = %q, esperado %q", got, want)
+	}
+}
+
+func TestFetchMaxSizeDuringResume(t *testing.T) {
+	content := testContent(4000)
+	o, srv := newOrigin(t, content)
+	d := newDownloader(t, srv)
+	d.MaxSize = 3000
+	rawURL := srv.URL + "/video.mp4"
+
+	// Sem tamanho total, o limite só pode ser aplicado durante a cópia
+	o.override = func(w http.ResponseWriter, r *http.Request) bool {
+		start := 0
+		if spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+			fmt.Sscanf(spec, "%d-", &start)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", start, len(content)-1))
+		w.WriteHeader(http.StatusPartialContent)
+		if start == 0 {
+			// Primeira tentativa interrompida antes do limite
+			_, _ = w.Write(content[:2000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		_, _ = w.Write(content[start:])
+		return true
+	}
+
+	if _, err := fetch(t, d, rawURL); err == nil || errors.Is(err, ErrTooLarge) {
+		t.Fatalf("a primeira tentativa deveria falhar pela conexão, não pelo limite: %v", err)
+	}
+	partPath, _ := partialPaths(d, rawURL)
+	if info, err := os.Stat(partPath); err != nil || info.Size() == 0 || info.Size() > d.MaxSize {
+		t.Fatalf("parcial inesperado: %v", err)
+	}
+
+	// A retomada soma o que já estava em disco ao que chega
+	if _, err := fetch(t, d, rawURL); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err = %v, esperado ErrTooLarge", err)
+	}
+	assertNoPartial(t, d, rawURL)
+}
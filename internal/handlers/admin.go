@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/config"
+)
+
+// RequireAdmin protege rotas administrativas com o token configurado em
+// ADMIN_API_TOKEN ou com uma API key de escopo admin. Sem nenhum dos dois,
+// as rotas ficam desabilitadas.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := auth.Caller(c); ok && key.HasScope(auth.ScopeAdmin) {
+			c.Next()
+			return
+		}
+		requireAdminToken(c)
+	}
+}
+
+// requireAdminToken confere o header X-Admin-Token contra ADMIN_API_TOKEN.
+func requireAdminToken(c *gin.Context) {
+	expected := config.AdminAPIToken()
+	if expected == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Rotas administrativas desabilitadas"})
+		return
+	}
+
+	provided := c.GetHeader("X-Admin-Token")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token administrativo inválido"})
+		return
+	}
+
+	c.Next()
+}
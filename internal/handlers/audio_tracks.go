@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/services"
+)
+
+var errInvalidAudioSelection = errors.New("seleção de stream de áudio inválida")
+
+// audioSelection indica quais streams de áudio de um vídeo devem ser extraídas.
+// O valor zero deixa o ffmpeg escolher a stream padrão, como antes.
+type audioSelection struct {
+	all      bool
+	index    int // -1 quando não especificado
+	language string
+}
+
+func parseAudioSelection(stream, language string) (audioSelection, error) {
+	sel := audioSelection{index: -1, language: strings.ToLower(strings.TrimSpace(language))}
+
+	stream = strings.ToLower(strings.TrimSpace(stream))
+	switch stream {
+	case "":
+	case "all":
+		sel.all = true
+	default:
+		index, err := strconv.Atoi(stream)
+		if err != nil || index < 0 {
+			return sel, fmt.Errorf("%w: audio_stream deve ser um índice ou \"all\"", errInvalidAudioSelection)
+		}
+		sel.index = index
+	}
+
+	if sel.all && sel.language != "" {
+		return sel, fmt.Errorf("%w: audio_stream=all não pode ser combinado com audio_language", errInvalidAudioSelection)
+	}
+	return sel, nil
+}
+
+func (s audioSelection) isDefault() bool {
+	return !s.all && s.index < 0 && s.language == ""
+}
+
+// selectAudioStreams resolve a seleção contra as streams encontradas pelo ffprobe.
+// Um elemento nil representa a stream padrão escolhida pelo ffmpeg.
+func selectAudioStreams(streams []media.AudioStream, sel audioSelection) ([]*media.AudioStream, error) {
+	if sel.isDefault() {
+		return []*media.AudioStream{nil}, nil
+	}
+
+	var selected []*media.AudioStream
+	for i := range streams {
+		stream := &streams[i]
+		switch {
+		case sel.all:
+			selected = append(selected, stream)
+		case sel.index >= 0:
+			if stream.Index == sel.index {
+				return []*media.AudioStream{stream}, nil
+			}
+		case strings.EqualFold(stream.Language, sel.language):
+			return []*media.AudioStream{stream}, nil
+		}
+	}
+
+	if len(selected) == 0 {
+		if sel.index >= 0 {
+			return nil, fmt.Errorf("%w: stream %d não é uma stream de áudio deste arquivo", errInvalidAudioSelection, sel.index)
+		}
+		if sel.language != "" {
+			return nil, fmt.Errorf("%w: nenhuma stream de áudio com idioma %q", errInvalidAudioSelection, sel.language)
+		}
+		return nil, fmt.Errorf("%w: o arquivo não possui streams de áudio", errInvalidAudioSelection)
+	}
+	return selected, nil
+}
+
+// extractedTrack é uma stream de áudio já extraída e enviada ao Drive,
+// aguardando ser gravada no armazenamento.
+type extractedTrack struct {
+	stream    *media.AudioStream
+	tempPath  string
+	driveName string
+	fileID    string
+}
+
+// extractAudioTracks extrai e envia ao Drive cada stream selecionada.
+// Os arquivos temporários devem ser removidos pelo chamador, mesmo em erro.
+func extractAudioTracks(ctx context.Context, req uploadRequest, metadata *media.Metadata, probeErr error, report jobs.Reporter) ([]media.AudioStream, []extractedTrack, error) {
+	if probeErr != nil && !req.audioSelection.isDefault() {
+		return nil, nil, probeErr
+	}
+
+	streams := []media.AudioStream{}
+	if metadata != nil {
+		streams = metadata.AudioStreams()
+	}
+
+	selected, err := selectAudioStreams(streams, req.audioSelection)
+	if err != nil {
+		return streams, nil, err
+	}
+
+	var tracks []extractedTrack
+	for _, stream := range selected {
+		if err := ctx.Err(); err != nil {
+			return streams, tracks, err
+		}
+
+		streamIndex := -1
+		driveName := media.BuildAudioFileName(req.driveFileName, req.storeName, req.audioProfile)
+		if stream != nil {
+			streamIndex = stream.Index
+			driveName = media.BuildAudioTrackFileName(req.driveFileName, req.storeName, req.audioProfile, *stream)
+		}
+
+		report.Stage(jobs.StageAudioExtract)
+		mediaCtx, cancel := mediaContext(ctx)
+		tempPath, err := media.ExtractAudio(mediaCtx, req.filePath, req.audioProfile, streamIndex)
+		cancel()
+		if err != nil {
+			return streams, tracks, err
+		}
+		track := extractedTrack{stream: stream, tempPath: tempPath, driveName: driveName}
+		tracks = append(tracks, track)
+
+		report.Stage(jobs.StageAudioUpload)
+		fileID, err := services.UploadFile(ctx, req.credentials, tempPath, req.folderID, driveName, uploadOptions(report))
+		if err != nil {
+			return streams, tracks, err
+		}
+		tracks[len(tracks)-1].fileID = fileID
+	}
+
+	return streams, tracks, nil
+}
+
+func removeTrackFiles(tracks []extractedTrack) {
+	for _, track := range tracks {
+		_ = os.Remove(track.tempPath)
+	}
+}
+
+func audioTrackResponse(track extractedTrack, fileURL string) gin.H {
+	entry := gin.H{
+		"stream_index":   nil,
+		"language":       nil,
+		"audio_file_id":  track.fileID,
+		"audio_file_url": fileURL,
+	}
+	if track.stream != nil {
+		entry["stream_index"] = track.stream.Index
+		if track.stream.Language != "" {
+			entry["language"] = track.stream.Language
+		}
+	}
+	return entry
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/history"
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/pkg/logger"
+)
+
+// batchBodyLimit limita o JSON de /upload-url/batch; os arquivos vêm das URLs.
+const batchBodyLimit = 1 << 20
+
+// batchItem é uma entrada de /upload-url/batch.
+type batchItem struct {
+	URL      string `json:"url"`
+	FolderID string `json:"folder_id"`
+	FileName string `json:"file_name"`
+}
+
+// batchRequest é o formato em objeto do lote: os itens mais as opções
+// compartilhadas por todos eles, com os mesmos nomes dos campos de /upload-url.
+type batchRequest struct {
+	Items         []batchItem `json:"items"`
+	FolderID      string      `json:"folder_id"`
+	AudioProfile  formField   `json:"audio_profile"`
+	AudioStream   formField   `json:"audio_stream"`
+	AudioLanguage formField   `json:"audio_language"`
+	Thumbnail     formField   `json:"thumbnail"`
+	ThumbnailAt   formField   `json:"thumbnail_at"`
+	Storyboard    formField   `json:"storyboard"`
+	Transcode     formField   `json:"transcode"`
+	TranscodeLow  formField   `json:"transcode_low"`
+	HLS           formField   `json:"hls"`
+	Dedupe        formField   `json:"dedupe"`
+	Async         formField   `json:"async"`
+}
+
+// formField aceita string, número ou booleano e guarda o valor como texto,
+// para reaproveitar os parsers dos campos de formulário.
+type formField string
+
+func (f *formField) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		*f = ""
+	case string:
+		*f = formField(v)
+	case bool, float64:
+		*f = formField(strings.TrimSpace(string(data)))
+	default:
+		return fmt.Errorf("valor inválido: %s", data)
+	}
+	return nil
+}
+
+// batchResult é o resultado de um item de um lote ou de um arquivo de um
+// /upload com várias partes; falhas não interrompem os demais.
+type batchResult struct {
+	Index      int    `json:"index"`
+	URL        string `json:"url,omitempty"`
+	FileName   string `json:"file_name,omitempty"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code"`
+	Result     gin.H  `json:"result,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// UploadURLBatch baixa e envia várias URLs em um único pedido. O corpo é um
+// array de {url, folder_id, file_name} ou um objeto com "items" e as opções
+// comuns; com async=true o lote inteiro vira um job.
+func UploadURLBatch(c *gin.Context) {
+	credentials, err := requestCredentials(c)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	batch, err := decodeBatchRequest(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := auth.FinishBody(c.Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(batch.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nenhuma URL fornecida"})
+		return
+	}
+	if limit := config.BatchMaxItems(); limit > 0 && len(batch.Items) > limit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("O lote excede o limite de %d itens", limit)})
+		return
+	}
+
+	audioProfile, err := resolveAudioProfile(string(batch.AudioProfile))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	selection, err := parseAudioSelection(string(batch.AudioStream), string(batch.AudioLanguage))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previews, err := parsePreviewOptions(string(batch.Thumbnail), string(batch.ThumbnailAt), string(batch.Storyboard))
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	transcodeOpts, err := parseTranscodeOptions(string(batch.Transcode), string(batch.TranscodeLow))
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	packageHLS, err := parseFlagField("hls", string(batch.HLS))
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	reuseDuplicate, err := parseFlagField("dedupe", string(batch.Dedupe))
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	base := uploadRequest{
+		credentials:    credentials,
+		folderID:       batch.FolderID,
+		audioProfile:   audioProfile,
+		audioSelection: selection,
+		previews:       previews,
+		transcode:      transcodeOpts,
+		hls:            packageHLS,
+		dedupe:         reuseDuplicate,
+		source:         requestSource(c, history.SourceURL),
+		publicBaseURL:  publicBaseURL(c),
+	}
+
+	if !wantsAsync(c.Query("async")) && !wantsAsync(string(batch.Async)) {
+		c.JSON(http.StatusOK, runBatch(c.Request.Context(), base, batch.Items))
+		return
+	}
+
+	// O download também acontece dentro do job, para o pedido responder na hora
+	job, err := submitJob(c, credentials, func(ctx context.Context, _ jobs.Reporter) (any, error) {
+		return runBatch(ctx, base, batch.Items), nil
+	})
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": base.publicBaseURL + "/jobs/" + job.ID,
+		"items":      len(batch.Items),
+	})
+}
+
+func decodeBatchRequest(body io.Reader) (batchRequest, error) {
+	var batch batchRequest
+	data, err := io.ReadAll(io.LimitReader(body, batchBodyLimit+1))
+	if err != nil {
+		return batch, fmt.Errorf("falha ao ler o corpo: %w", err)
+	}
+	if len(data) > batchBodyLimit {
+		return batch, errors.New("corpo do lote muito grande")
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &batch.Items)
+	} else {
+		err = json.Unmarshal(data, &batch)
+	}
+	if err != nil {
+		return batch, fmt.Errorf("JSON do lote inválido: %w", err)
+	}
+	return batch, nil
+}
+
+// runBatch processa os itens com no máximo BATCH_CONCURRENCY ao mesmo tempo,
+// mantendo os resultados na ordem do pedido.
+func runBatch(ctx context.Context, base uploadRequest, items []batchItem) gin.H {
+	concurrency := config.BatchConcurrency()
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]batchResult, len(items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				response, err := uploadBatchItem(ctx, base, item)
+				results[i] = batchItemResult(i, item, response, err)
+			case <-ctx.Done():
+				results[i] = batchItemResult(i, item, nil, ctx.Err())
+			}
+		}()
+	}
+	wg.Wait()
+
+	return batchSummary(results)
+}
+
+func batchItemResult(index int, item batchItem, response gin.H, err error) batchResult {
+	result := newBatchResult(index, response, err)
+	result.URL = item.URL
+	return result
+}
+
+func newBatchResult(index int, response gin.H, err error) batchResult {
+	result := batchResult{Index: index}
+	if err != nil {
+		result.Status = "failed"
+		result.StatusCode, result.Error = uploadErrorStatus(err)
+		logger.Info(fmt.Sprintf("lote: item %d falhou: %s", index, result.Error))
+		return result
+	}
+	result.Status = "done"
+	result.StatusCode = http.StatusOK
+	result.Result = response
+	return result
+}
+
+func batchSummary(results []batchResult) gin.H {
+	succeeded := 0
+	for _, result := range results {
+		if result.Error == "" {
+			succeeded++
+		}
+	}
+	return gin.H{
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	}
+}
+
+// uploadBatchItem executa para um item o mesmo fluxo de /upload-url.
+func uploadBatchItem(ctx context.Context, base uploadRequest, item batchItem) (gin.H, error) {
+	if strings.TrimSpace(item.URL) == "" {
+		return nil, &requestError{http.StatusBadRequest, "Nenhuma URL fornecida"}
+	}
+
+	storeName, filePath, err := fetchRemoteFile(ctx, item.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType, err := media.DetectMimeType(filePath)
+	if err != nil {
+		_ = os.Remove(filePath)
+		return nil, err
+	}
+
+	req := base
+	req.filePath = filePath
+	req.storeName = storeName
+	req.driveFileName = item.FileName
+	req.mimeType = mimeType
+	req.source.url = item.URL
+	if item.FolderID != "" {
+		req.folderID = item.FolderID
+	}
+
+	response, err := buildUploadResponse(ctx, req, jobs.NopReporter)
+	if err != nil {
+		_ = os.Remove(filePath)
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/services"
+	"upload-drive-script/pkg/logger"
+)
+
+// requestCredentials escolhe as credenciais do Drive para a requisição.
+//
+// O modo vem do header X-Drive-Auth-Mode (ou é implícito quando só
+// X-Drive-Refresh-Token é enviado) e precisa estar em DRIVE_AUTH_ALLOWED_MODES;
+// sem header, vale DRIVE_AUTH_MODE. Segredos guardados no servidor (refresh
+// token e chave da service account) só são usados quando o modo está liberado.
+func requestCredentials(c *gin.Context) (services.CredentialProvider, error) {
+	mode, fromRequest := credentialMode(c)
+	if fromRequest && !slices.Contains(config.DriveAuthAllowedModes(), mode) {
+		return nil, &requestError{http.StatusForbidden, "Modo de autenticação não permitido: " + mode}
+	}
+	refreshToken := strings.TrimSpace(c.GetHeader("X-Drive-Refresh-Token"))
+
+	switch mode {
+	case services.AuthModeAccessToken:
+		creds := services.AccessTokenCredentials{AccessToken: bearerToken(c)}
+		if info, ok := auth.Identity(c); ok {
+			creds.Subject = info.Subject
+		}
+		return creds, nil
+	case services.AuthModeRefreshToken:
+		if refreshToken == "" && !fromRequest {
+			refreshToken = config.GoogleRefreshToken()
+		}
+		if refreshToken == "" {
+			return nil, &requestError{http.StatusUnauthorized, "Refresh token não informado (header X-Drive-Refresh-Token)"}
+		}
+		if config.GoogleClientID() == "" || config.GoogleClientSecret() == "" {
+			return nil, &requestError{http.StatusInternalServerError, "GOOGLE_CLIENT_ID e GOOGLE_CLIENT_SECRET não configurados"}
+		}
+		return services.RefreshTokenCredentials{
+			ClientID:     config.GoogleClientID(),
+			ClientSecret: config.GoogleClientSecret(),
+			RefreshToken: refreshToken,
+		}, nil
+	case services.AuthModeServiceAccount:
+		keyPath := config.GoogleServiceAccountFile()
+		if keyPath == "" {
+			return nil, &requestError{http.StatusInternalServerError, "GOOGLE_SERVICE_ACCOUNT_FILE não configurado"}
+		}
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			logger.Error("ler chave da service account: " + err.Error())
+			return nil, &requestError{http.StatusInternalServerError, "Não foi possível ler a chave da service account"}
+		}
+		subject := config.GoogleServiceAccountSubject()
+		if requested := strings.TrimSpace(c.GetHeader("X-Drive-Subject")); requested != "" {
+			if !subjectAllowed(c, requested) {
+				return nil, &requestError{http.StatusForbidden, "Usuário não permitido em X-Drive-Subject: " + requested}
+			}
+			subject = requested
+		}
+		return services.ServiceAccountCredentials{JSONKey: key, Subject: subject}, nil
+	default:
+		return nil, &requestError{http.StatusBadRequest, "Modo de autenticação desconhecido: " + mode}
+	}
+}
+
+// subjectAllowed impede que qualquer cliente personifique qualquer usuário do
+// domínio: só valem os subjects de GOOGLE_SERVICE_ACCOUNT_ALLOWED_SUBJECTS, o
+// subject padrão ou API keys com escopo admin.
+func subjectAllowed(c *gin.Context, subject string) bool {
+	if key, ok := auth.Caller(c); ok && key.HasScope(auth.ScopeAdmin) {
+		return true
+	}
+	if strings.EqualFold(subject, config.GoogleServiceAccountSubject()) {
+		return true
+	}
+	return slices.ContainsFunc(config.GoogleServiceAccountAllowedSubjects(), func(allowed string) bool {
+		return strings.EqualFold(allowed, subject)
+	})
+}
+
+// UsesForwardedToken reports whether the request authenticates on Drive with
+// the caller's own access token, the only mode whose token can be verified
+// before the upload starts.
+func UsesForwardedToken(c *gin.Context) bool {
+	mode, _ := credentialMode(c)
+	return mode == services.AuthModeAccessToken
+}
+
+// credentialMode resolve o modo pedido pela requisição ou, na ausência, o configurado.
+func credentialMode(c *gin.Context) (mode string, fromRequest bool) {
+	mode = strings.ToLower(strings.TrimSpace(c.GetHeader("X-Drive-Auth-Mode")))
+	if mode == "" && strings.TrimSpace(c.GetHeader("X-Drive-Refresh-Token")) != "" {
+		mode = services.AuthModeRefreshToken
+	}
+	if mode != "" {
+		return mode, true
+	}
+	return strings.ToLower(config.DriveAuthMode()), false
+}
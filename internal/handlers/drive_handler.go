@@ -1,32 +1,54 @@
 package handlers
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
-	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"upload-drive-script/internal/auth"
 	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/history"
+	"upload-drive-script/internal/jobs"
 	"upload-drive-script/internal/media"
 	"upload-drive-script/internal/services"
+	"upload-drive-script/internal/storage"
+	"upload-drive-script/pkg/logger"
 )
 
 var errUnsupportedMediaType = errors.New("tipo de arquivo não suportado")
 
+var (
+	fileStore storage.Backend
+	fileRefs  = storage.NewRefTracker()
+)
+
+// SetStorage configures the backend that keeps the copies served from /uploads
+// and the tracker shared with the retention janitor.
+func SetStorage(b storage.Backend, refs *storage.RefTracker) {
+	fileStore = b
+	fileRefs = refs
+}
+
 func Upload(c *gin.Context) {
-	// Extract token from header
-	authHeader := c.GetHeader("Authorization")
-	tokenString := ""
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+	credentials, err := requestCredentials(c)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	if exceedsMaxFileSize(c.Request.ContentLength, multipartOverhead) {
+		respondUploadError(c, fileTooLargeError())
+		return
 	}
 
 	// Usar MultipartReader para streaming
@@ -36,18 +58,22 @@ func Upload(c *gin.Context) {
 		return
 	}
 
+	async := wantsAsync(c.Query("async"))
+	// Corpos assinados só podem ir ao Drive depois que o hash for conferido
+	bufferFirst := auth.PendingBodyHash(c.Request)
+	var files []receivedFile
 	var folderID string
 	var fileName string
-	var driveFileID string
-	var mimeType string
-	var filePath string
-	var fileNameOnDisk string
-	const uploadDir = "upload"
-
-	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao preparar diretório de upload"})
-		return
-	}
+	var audioProfileName string
+	var audioStream string
+	var audioLanguage string
+	var thumbnail string
+	var thumbnailAt string
+	var storyboard string
+	var transcode string
+	var transcodeLow string
+	var hls string
+	var dedupe string
 
 	for {
 		part, err := reader.NextPart()
@@ -55,6 +81,7 @@ func Upload(c *gin.Context) {
 			break
 		}
 		if err != nil {
+			removeReceivedFiles(files)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler parte do formulário"})
 			return
 		}
@@ -63,6 +90,7 @@ func Upload(c *gin.Context) {
 		case "folder_id":
 			buf := new(strings.Builder)
 			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler folder_id"})
 				return
 			}
@@ -70,192 +98,275 @@ func Upload(c *gin.Context) {
 		case "file_name":
 			buf := new(strings.Builder)
 			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler file_name"})
 				return
 			}
 			fileName = buf.String()
-		case "file":
-			// Processo principal de upload
-			if fileName == "" {
-				fileName = part.FileName()
+		case "audio_profile":
+			buf := new(strings.Builder)
+			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler audio_profile"})
+				return
 			}
-
-			cleanName, err := sanitizeFilename(fileName)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			audioProfileName = buf.String()
+		case "audio_stream", "audio_language":
+			buf := new(strings.Builder)
+			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler " + part.FormName()})
 				return
 			}
-			fileNameOnDisk = ensureUniqueFilename(uploadDir, cleanName)
-			filePath = filepath.Join(uploadDir, fileNameOnDisk)
-
-			// Criar arquivo local para backup/processamento
-			out, err := os.Create(filePath)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar arquivo local"})
+			if part.FormName() == "audio_stream" {
+				audioStream = buf.String()
+			} else {
+				audioLanguage = buf.String()
+			}
+		case "thumbnail", "thumbnail_at", "storyboard":
+			buf := new(strings.Builder)
+			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler " + part.FormName()})
 				return
 			}
-			defer out.Close() // Fecha o arquivo ao final da função, mas fecharemos explicitamente antes do processamento
-
-			// TeeReader: Lê do part -> Escreve no out (disco) -> Retorna para o UploadFileStream
-			tee := io.TeeReader(part, out)
-
-			// Inicia Upload para o Drive usando o stream
-			// O upload lê do 'tee', que lê do 'part' e escreve em 'out' simultaneamente.
-			uploadedID, err := services.UploadFileStream(tokenString, tee, folderID, fileName)
-
-			// Importante: Fechar o arquivo local explicitamente para garantir flush antes de usar
-			out.Close()
-
-			if err != nil {
-				_ = os.Remove(filePath) // Limpa em caso de erro
-				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Erro no upload para o Drive: %v", err)})
+			switch part.FormName() {
+			case "thumbnail":
+				thumbnail = buf.String()
+			case "thumbnail_at":
+				thumbnailAt = buf.String()
+			default:
+				storyboard = buf.String()
+			}
+		case "transcode", "transcode_low":
+			buf := new(strings.Builder)
+			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler " + part.FormName()})
 				return
 			}
-
-			driveFileID = uploadedID
-
-			// Detectar mime type do arquivo salvo localmente
-			detectedMime, err := media.DetectMimeType(filePath)
-			if err != nil {
-				// Se falhar detecção, tenta pelo header (menos confiável, mas fallback)
-				// Se não, assume erro.
-				// Para robustez, vamos continuar ou retornar erro.
-				// Mas se falhou detect, talvez o arquivo esteja corrompido.
-				_ = os.Remove(filePath)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao detectar tipo de arquivo"})
+			if part.FormName() == "transcode" {
+				transcode = buf.String()
+			} else {
+				transcodeLow = buf.String()
+			}
+		case "hls":
+			buf := new(strings.Builder)
+			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler hls"})
+				return
+			}
+			hls = buf.String()
+		case "async":
+			// Só tem efeito quando enviado antes da parte "file"
+			buf := new(strings.Builder)
+			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler async"})
+				return
+			}
+			async = async || wantsAsync(buf.String())
+		case "dedupe":
+			// Também só antes da parte "file": o arquivo precisa do hash antes de ir ao Drive
+			buf := new(strings.Builder)
+			if _, err := io.Copy(buf, part); err != nil {
+				removeReceivedFiles(files)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler dedupe"})
 				return
 			}
-			mimeType = detectedMime
+			dedupe = buf.String()
+			if reuse, _ := parseFlagField("dedupe", dedupe); reuse {
+				bufferFirst = true
+			}
+		case "file":
+			// Cada file_name vale para a próxima parte "file"
+			file := receiveFilePart(c.Request.Context(), credentials, part, cmp.Or(fileName, part.FileName()), folderID, !async && !bufferFirst)
+			file.explicitName = fileName != ""
+			fileName = ""
+			files = append(files, file)
 		}
 	}
 
 	// Validar se houve processamento
-	if driveFileID == "" {
+	if len(files) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Nenhum arquivo enviado ou processado"})
 		return
 	}
 
-	// Validação de MimeType (estava em buildUploadResponse)
-	isVideo := media.IsVideoMime(mimeType)
-	isAudio := media.IsAudioMime(mimeType)
+	// Um file_name depois da última parte vale para ela, como no envio de um só arquivo
+	if last := &files[len(files)-1]; fileName != "" && !last.explicitName {
+		last.fileName = fileName
+	}
 
-	if !isVideo && !isAudio {
-		_ = os.Remove(filePath)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Apenas arquivos de áudio ou vídeo são permitidos"})
+	if err := auth.FinishBody(c.Request); err != nil {
+		removeReceivedFiles(files)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	finalResponse := gin.H{
-		"video_file_id":  nil,
-		"audio_file_id":  nil,
-		"video_file_url": nil,
-		"audio_file_url": nil,
+	audioProfile, err := resolveAudioProfile(audioProfileName)
+	if err != nil {
+		removeReceivedFiles(files)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if isVideo {
-		finalResponse["video_file_id"] = driveFileID
-		finalResponse["video_file_url"] = buildPublicFileURL(c, fileNameOnDisk)
+	selection, err := parseAudioSelection(audioStream, audioLanguage)
+	if err != nil {
+		removeReceivedFiles(files)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		// Extração de áudio
-		audioTempPath, err := media.ExtractAudio(filePath)
-		if err != nil {
-			// Se falhar converter áudio, retornamos erro? Ou só o vídeo?
-			// Código original retornava erro.
-			_ = os.Remove(filePath)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	previews, err := parsePreviewOptions(thumbnail, thumbnailAt, storyboard)
+	if err != nil {
+		removeReceivedFiles(files)
+		respondUploadError(c, err)
+		return
+	}
 
-		audioDriveName := media.BuildAudioFileName(fileName, filePath)
-		audioFileNameOnDisk, audioFilePath, err := persistGeneratedFile(uploadDir, audioTempPath, audioDriveName)
-		if err != nil {
-			_ = os.Remove(audioTempPath)
-			_ = os.Remove(filePath)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	transcodeOpts, err := parseTranscodeOptions(transcode, transcodeLow)
+	if err != nil {
+		removeReceivedFiles(files)
+		respondUploadError(c, err)
+		return
+	}
 
-		// Upload do áudio (ainda usa arquivo local, tudo bem ser pequeno)
-		audioFileID, err := services.UploadFile(tokenString, audioFilePath, folderID, audioDriveName)
-		if err != nil {
-			_ = os.Remove(filePath)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		finalResponse["audio_file_id"] = audioFileID
-		finalResponse["audio_file_url"] = buildPublicFileURL(c, audioFileNameOnDisk)
-	} else {
-		finalResponse["audio_file_id"] = driveFileID
-		finalResponse["audio_file_url"] = buildPublicFileURL(c, fileNameOnDisk)
+	packageHLS, err := parseFlagField("hls", hls)
+	if err != nil {
+		removeReceivedFiles(files)
+		respondUploadError(c, err)
+		return
+	}
+
+	reuseDuplicate, err := parseFlagField("dedupe", dedupe)
+	if err != nil {
+		removeReceivedFiles(files)
+		respondUploadError(c, err)
+		return
 	}
 
-	c.JSON(http.StatusOK, finalResponse)
+	base := uploadRequest{
+		credentials:    credentials,
+		folderID:       folderID,
+		audioProfile:   audioProfile,
+		audioSelection: selection,
+		previews:       previews,
+		transcode:      transcodeOpts,
+		hls:            packageHLS,
+		dedupe:         reuseDuplicate,
+		source:         requestSource(c, history.SourceMultipart),
+		publicBaseURL:  publicBaseURL(c),
+	}
+
+	if len(files) > 1 {
+		respondMultipleFiles(c, base, files, async)
+		return
+	}
+
+	if files[0].err != nil {
+		respondUploadError(c, files[0].err)
+		return
+	}
+	req := files[0].request(base)
+
+	if async {
+		submitUploadJob(c, req)
+		return
+	}
+
+	response, err := buildUploadResponse(c.Request.Context(), req, jobs.NopReporter)
+	if err != nil {
+		_ = os.Remove(req.filePath)
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// respondMultipleFiles processa um /upload com várias partes "file" e
+// responde com um resultado por arquivo, ou com um único job para todos.
+func respondMultipleFiles(c *gin.Context, base uploadRequest, files []receivedFile, async bool) {
+	if !async {
+		c.JSON(http.StatusOK, processReceivedFiles(c.Request.Context(), base, files, jobs.NopReporter))
+		return
+	}
+
+	job, err := submitJob(c, base.credentials, func(ctx context.Context, report jobs.Reporter) (any, error) {
+		return processReceivedFiles(ctx, base, files, report), nil
+	})
+	if err != nil {
+		removeReceivedFiles(files)
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": base.publicBaseURL + "/jobs/" + job.ID,
+		"files":      len(files),
+	})
 }
 
 func UploadURL(c *gin.Context) {
-	// Extract token from header
-	authHeader := c.GetHeader("Authorization")
-	tokenString := ""
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+	credentials, err := requestCredentials(c)
+	if err != nil {
+		respondUploadError(c, err)
+		return
 	}
 
 	fileURL := c.PostForm("url")
+	if err := auth.FinishBody(c.Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if fileURL == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Nenhuma URL fornecida"})
 		return
 	}
 
-	parsedURL, err := url.Parse(fileURL)
-	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "URL inválida"})
+	audioProfile, err := resolveAudioProfile(c.PostForm("audio_profile"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Apenas URLs HTTP/HTTPS são permitidas"})
+	selection, err := parseAudioSelection(c.PostForm("audio_stream"), c.PostForm("audio_language"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	host := parsedURL.Host
-	if strings.Contains(host, "@") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "URL com credenciais embutidas não é permitida"})
+	previews, err := parsePreviewOptions(c.PostForm("thumbnail"), c.PostForm("thumbnail_at"), c.PostForm("storyboard"))
+	if err != nil {
+		respondUploadError(c, err)
 		return
 	}
 
-	if h, _, splitErr := net.SplitHostPort(host); splitErr == nil {
-		host = h
-	}
-	if strings.EqualFold(host, "localhost") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "URL não permitida"})
+	transcodeOpts, err := parseTranscodeOptions(c.PostForm("transcode"), c.PostForm("transcode_low"))
+	if err != nil {
+		respondUploadError(c, err)
 		return
 	}
-	trimmedHost := strings.Trim(host, "[]")
-	if ip := net.ParseIP(trimmedHost); ip != nil {
-		if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "URL não permitida"})
-			return
-		}
-	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(parsedURL.String())
-	if err != nil || resp.StatusCode != 200 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Não foi possível baixar o arquivo"})
+	packageHLS, err := parseFlagField("hls", c.PostForm("hls"))
+	if err != nil {
+		respondUploadError(c, err)
 		return
 	}
-	defer resp.Body.Close()
-
-	const uploadDir = "upload"
 
-	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao preparar diretório de upload"})
+	reuseDuplicate, err := parseFlagField("dedupe", c.PostForm("dedupe"))
+	if err != nil {
+		respondUploadError(c, err)
 		return
 	}
 
-	fileNameOnDisk, filePath, err := saveRemoteFile(resp.Body, uploadDir, parsedURL.Path)
+	storeName, filePath, err := fetchRemoteFile(c.Request.Context(), fileURL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUploadError(c, err)
 		return
 	}
 
@@ -270,14 +381,33 @@ func UploadURL(c *gin.Context) {
 		return
 	}
 
-	response, err := buildUploadResponse(c, tokenString, uploadDir, filePath, fileNameOnDisk, folderID, fileName, mimeType)
+	req := uploadRequest{
+		credentials:    credentials,
+		filePath:       filePath,
+		storeName:      storeName,
+		folderID:       folderID,
+		driveFileName:  fileName,
+		mimeType:       mimeType,
+		audioProfile:   audioProfile,
+		audioSelection: selection,
+		previews:       previews,
+		transcode:      transcodeOpts,
+		hls:            packageHLS,
+		dedupe:         reuseDuplicate,
+		source:         requestSource(c, history.SourceURL),
+		publicBaseURL:  publicBaseURL(c),
+	}
+	req.source.url = fileURL
+
+	if wantsAsync(c.Query("async")) || wantsAsync(c.PostForm("async")) {
+		submitUploadJob(c, req)
+		return
+	}
+
+	response, err := buildUploadResponse(c.Request.Context(), req, jobs.NopReporter)
 	if err != nil {
 		_ = os.Remove(filePath)
-		if errors.Is(err, errUnsupportedMediaType) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Apenas arquivos de áudio ou vídeo são permitidos"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUploadError(c, err)
 		return
 	}
 
@@ -293,11 +423,21 @@ func GetUploadedFile(c *gin.Context) {
 		return
 	}
 
-	const uploadDir = "upload"
+	if urlSigner != nil && path.Ext(fileName) == ".vtt" {
+		serveStoryboardVTT(c, fileName)
+		return
+	}
+	serveStoredFile(c, fileName)
+}
 
-	filePath := filepath.Join(uploadDir, fileName)
+// serveStoredFile envia name a partir do armazenamento, com suporte a Range.
+func serveStoredFile(c *gin.Context, name string) {
+	release := fileRefs.Acquire(name)
+	defer release()
 
-	if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
+	ctx := c.Request.Context()
+	info, err := fileStore.Stat(ctx, name)
+	if errors.Is(err, storage.ErrNotExist) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
 		return
 	} else if err != nil {
@@ -305,7 +445,65 @@ func GetUploadedFile(c *gin.Context) {
 		return
 	}
 
-	c.File(filePath)
+	if local, ok := fileStore.(*storage.Local); ok {
+		if filePath, err := local.Path(name); err == nil {
+			c.File(filePath)
+			return
+		}
+	}
+
+	content := storage.NewReadSeeker(ctx, fileStore, name, info.Size)
+	defer content.Close()
+	http.ServeContent(c.Writer, c.Request, path.Base(name), info.ModTime, content)
+}
+
+// maxRewrittenFileSize limita os arquivos de texto reescritos na entrega
+// (playlists HLS e índices WebVTT).
+const maxRewrittenFileSize = 4 << 20
+
+// readStoredText lê um arquivo de texto pequeno do armazenamento. Em caso de
+// falha a resposta de erro já foi enviada.
+func readStoredText(c *gin.Context, name string) (string, bool) {
+	rc, _, err := fileStore.Get(c.Request.Context(), name)
+	if errors.Is(err, storage.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return "", false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao acessar arquivo"})
+		return "", false
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxRewrittenFileSize+1))
+	if err != nil || len(data) > maxRewrittenFileSize {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao acessar arquivo"})
+		return "", false
+	}
+	return string(data), true
+}
+
+func DeleteUploadedFile(c *gin.Context) {
+	fileName, err := sanitizeFilename(c.Param("filename"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome de arquivo inválido"})
+		return
+	}
+
+	if fileRefs.InUse(fileName) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Arquivo em uso, tente novamente mais tarde"})
+		return
+	}
+
+	if err := fileStore.Delete(c.Request.Context(), fileName); errors.Is(err, storage.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover arquivo"})
+		return
+	}
+
+	logger.Info("arquivo removido manualmente: " + fileName)
+	c.JSON(http.StatusOK, gin.H{"deleted": fileName})
 }
 
 func sanitizeFilename(name string) (string, error) {
@@ -326,26 +524,18 @@ func sanitizeFilename(name string) (string, error) {
 	return cleanName, nil
 }
 
-func ensureUniqueFilename(dir, name string) string {
-	ext := filepath.Ext(name)
-	base := strings.TrimSuffix(name, ext)
-	candidate := name
-	counter := 1
-
-	for {
-		if _, err := os.Stat(filepath.Join(dir, candidate)); errors.Is(err, os.ErrNotExist) {
-			return candidate
-		}
-
-		candidate = fmt.Sprintf("%s-%d%s", base, counter, ext)
-		counter++
-	}
+// buildPublicFileURL monta a URL de /uploads devolvida ao cliente, assinada
+// por SIGNED_URL_TTL quando SIGNED_URL_SECRET está configurado.
+func buildPublicFileURL(baseURL, filename string) string {
+	fileURL, _ := signedFileURL(baseURL, filename, config.SignedURLTTL())
+	return fileURL
 }
 
-func buildPublicFileURL(c *gin.Context, filename string) string {
+// publicBaseURL resolve o prefixo (esquema + host) usado nas URLs públicas.
+// Retorna string vazia quando não há host conhecido, gerando URLs relativas.
+func publicBaseURL(c *gin.Context) string {
 	if baseURL, ok := config.PublicBaseURL(); ok {
-		prefix := strings.TrimSuffix(baseURL.String(), "/")
-		return prefix + "/uploads/" + url.PathEscape(filename)
+		return strings.TrimSuffix(baseURL.String(), "/")
 	}
 
 	scheme := c.Request.Header.Get("X-Forwarded-Proto")
@@ -363,152 +553,363 @@ func buildPublicFileURL(c *gin.Context, filename string) string {
 	}
 
 	if host == "" {
-		return "/uploads/" + url.PathEscape(filename)
+		return ""
 	}
 
-	return scheme + "://" + host + "/uploads/" + url.PathEscape(filename)
+	return scheme + "://" + host
 }
 
-func buildUploadResponse(
-	c *gin.Context,
-	tokenString string,
-	uploadDir string,
-	filePath string,
-	fileNameOnDisk string,
-	folderID string,
-	driveFileName string,
-	mimeType string,
-) (gin.H, error) {
-	isVideo := media.IsVideoMime(mimeType)
-	isAudio := media.IsAudioMime(mimeType)
+// uploadRequest reúne o que o pipeline precisa para processar um arquivo já salvo em disco.
+type uploadRequest struct {
+	credentials    services.CredentialProvider
+	filePath       string // arquivo na área de staging
+	storeName      string // nome preferido no armazenamento servido em /uploads
+	folderID       string
+	driveFileName  string
+	mimeType       string
+	driveFileID    string // preenchido quando o arquivo já foi enviado ao Drive via stream
+	audioProfile   media.AudioProfile
+	audioSelection audioSelection
+	previews       previewOptions
+	transcode      transcodeOptions
+	hls            bool
+	dedupe         bool           // reaproveita um upload anterior do mesmo conteúdo
+	hashes         *contentHashes // calculados durante o recebimento, quando possível
+	source         uploadSource
+	publicBaseURL  string
+	refs           *requestRefs // preenchido por runUploadPipeline
+}
+
+// requestRefs mantém em uso, até o fim do pipeline, os arquivos que ele grava
+// no armazenamento, para que o janitor não os remova antes da resposta.
+type requestRefs struct {
+	releases []func()
+}
+
+func (r *requestRefs) hold(release func()) {
+	r.releases = append(r.releases, release)
+}
+
+func (r *requestRefs) acquire(name string) {
+	r.hold(fileRefs.Acquire(name))
+}
+
+func (r *requestRefs) release() {
+	for _, release := range r.releases {
+		release()
+	}
+	r.releases = nil
+}
+
+// buildUploadResponse roda o pipeline e registra o resultado no histórico,
+// com sucesso ou não.
+func buildUploadResponse(ctx context.Context, req uploadRequest, report jobs.Reporter) (gin.H, error) {
+	startedAt := time.Now()
+	outcome := &uploadOutcome{}
+	response, err := runUploadPipeline(ctx, req, report, outcome)
+	recordHistory(req, outcome, startedAt, response, err)
+	return response, err
+}
+
+func runUploadPipeline(ctx context.Context, req uploadRequest, report jobs.Reporter, outcome *uploadOutcome) (gin.H, error) {
+	req.refs = &requestRefs{}
+	defer req.refs.release()
+
+	isVideo := media.IsVideoMime(req.mimeType)
+	isAudio := media.IsAudioMime(req.mimeType)
 
 	if !isVideo && !isAudio {
 		return nil, errUnsupportedMediaType
 	}
 
+	hashes := req.hashes
+	if hashes == nil {
+		var err error
+		if hashes, err = hashFile(req.filePath); err != nil {
+			return nil, err
+		}
+	}
+	outcome.hashes = hashes
+	if info, err := os.Stat(req.filePath); err == nil {
+		outcome.size = info.Size()
+	}
+
 	response := gin.H{
 		"video_file_id":  nil,
 		"audio_file_id":  nil,
 		"video_file_url": nil,
 		"audio_file_url": nil,
+		"hashes":         hashes,
+		"duplicate":      false,
+	}
+
+	probeCtx, cancel := mediaContext(ctx)
+	metadata, probeErr := media.Probe(probeCtx, req.filePath)
+	cancel()
+	if probeErr != nil {
+		// Metadados são informativos; a falha só é fatal se a seleção de áudio depender deles
+		logger.Error(probeErr.Error())
+	}
+	response["metadata"] = metadata
+
+	fileID := req.driveFileID
+	// Só dá para reaproveitar um upload anterior se este ainda não foi ao Drive
+	if req.dedupe && fileID == "" {
+		if entry, ok := duplicateUpload(ctx, req, hashes); ok {
+			fileID = entry.DriveFileID
+			outcome.duplicate = true
+			response["duplicate"] = true
+			response["duplicate_of"] = entry.CreatedAt
+		}
 	}
-
-	if isVideo {
-		videoFileID, err := services.UploadFile(tokenString, filePath, folderID, driveFileName)
+	if fileID == "" {
+		report.Stage(jobs.StageDriveUpload)
+		opts := uploadOptions(report)
+		opts.SHA256 = hashes.SHA256
+		uploadedID, err := services.UploadFile(ctx, req.credentials, req.filePath, req.folderID, req.driveFileName, opts)
 		if err != nil {
 			return nil, err
 		}
-		response["video_file_id"] = videoFileID
-		response["video_file_url"] = buildPublicFileURL(c, fileNameOnDisk)
+		fileID = uploadedID
+	}
+	// O arquivo reaproveitado já teve o checksum conferido em duplicateUpload
+	if !outcome.duplicate {
+		if err := verifyDriveChecksum(ctx, req, fileID, hashes); err != nil {
+			return nil, err
+		}
+	}
 
-		audioTempPath, err := media.ExtractAudio(filePath)
+	if !isVideo {
+		hlsStreams, err := generateStreams(ctx, req, "", nil, req.filePath, metadata, report)
+		defer hlsStreams.cleanup()
 		if err != nil {
 			return nil, err
 		}
 
-		audioDriveName := media.BuildAudioFileName(driveFileName, filePath)
-		audioFileNameOnDisk, audioFilePath, err := persistGeneratedFile(uploadDir, audioTempPath, audioDriveName)
+		storedName, err := persistFile(ctx, req.refs, req.storeName, req.filePath)
 		if err != nil {
-			_ = os.Remove(audioTempPath)
 			return nil, err
 		}
-
-		audioFileID, err := services.UploadFile(tokenString, audioFilePath, folderID, audioDriveName)
+		streamNames, err := storeStreams(ctx, req, hlsStreams, response)
 		if err != nil {
+			for _, name := range append(streamNames, storedName) {
+				_ = fileStore.Delete(ctx, name)
+			}
 			return nil, err
 		}
-		response["audio_file_id"] = audioFileID
-		response["audio_file_url"] = buildPublicFileURL(c, audioFileNameOnDisk)
+		response["audio_file_id"] = fileID
+		response["audio_file_url"] = buildPublicFileURL(req.publicBaseURL, storedName)
+		recordUpload(req, hashes, outcome.size, response, storedName, "")
+		outcome.storedNames = append(streamNames, storedName)
 		return response, nil
 	}
 
-	audioFileID, err := services.UploadFile(tokenString, filePath, folderID, driveFileName)
+	streams, tracks, err := extractAudioTracks(ctx, req, metadata, probeErr, report)
+	defer removeTrackFiles(tracks)
 	if err != nil {
 		return nil, err
 	}
-	response["audio_file_id"] = audioFileID
-	response["audio_file_url"] = buildPublicFileURL(c, fileNameOnDisk)
 
-	return response, nil
-}
+	previews, err := generatePreviews(ctx, req, metadata, report)
+	defer previews.cleanup()
+	if err != nil {
+		return nil, err
+	}
 
-func persistGeneratedFile(uploadDir, tempPath, preferredName string) (string, string, error) {
-	filename, err := sanitizeFilename(preferredName)
+	renditions, err := generateRenditions(ctx, req, metadata, report)
+	defer removeRenditionFiles(renditions)
 	if err != nil {
-		return "", "", fmt.Errorf("nome de arquivo inválido para áudio: %w", err)
+		return nil, err
 	}
-	filename = ensureUniqueFilename(uploadDir, filename)
-	destPath := filepath.Join(uploadDir, filename)
 
-	if err := moveFile(tempPath, destPath); err != nil {
-		return "", "", err
+	var audioPath string
+	if len(tracks) > 0 {
+		audioPath = tracks[0].tempPath
+	}
+	hlsStreams, err := generateStreams(ctx, req, req.filePath, metadata, audioPath, nil, report)
+	defer hlsStreams.cleanup()
+	if err != nil {
+		return nil, err
 	}
 
-	return filename, destPath, nil
-}
+	// As cópias locais só são gravadas depois que tudo deu certo, para não deixar órfãos no armazenamento
+	videoStoredName, err := persistFile(ctx, req.refs, req.storeName, req.filePath)
+	if err != nil {
+		return nil, err
+	}
+	response["video_file_id"] = fileID
+	response["video_file_url"] = buildPublicFileURL(req.publicBaseURL, videoStoredName)
+
+	storedNames := []string{videoStoredName}
+	succeeded := false
+	defer func() {
+		// Se alguma cópia falhar, remove as que já foram gravadas
+		if !succeeded {
+			for _, name := range storedNames {
+				_ = fileStore.Delete(ctx, name)
+			}
+		}
+	}()
 
-func moveFile(src, dst string) error {
-	if err := os.Rename(src, dst); err == nil {
-		return nil
+	audioTracks := make([]gin.H, 0, len(tracks))
+	for _, track := range tracks {
+		audioStoredName, err := persistGeneratedFile(ctx, req.refs, track.tempPath, track.driveName)
+		if err != nil {
+			return nil, err
+		}
+		storedNames = append(storedNames, audioStoredName)
+		audioTracks = append(audioTracks, audioTrackResponse(track, buildPublicFileURL(req.publicBaseURL, audioStoredName)))
 	}
 
-	in, err := os.Open(src)
+	previewNames, err := storePreviews(ctx, req, previews, response)
+	storedNames = append(storedNames, previewNames...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer in.Close()
 
-	out, err := os.Create(dst)
+	renditionNames, err := storeRenditions(ctx, req, renditions, response)
+	storedNames = append(storedNames, renditionNames...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if _, err := io.Copy(out, in); err != nil {
-		out.Close()
-		_ = os.Remove(dst)
-		return err
+	streamNames, err := storeStreams(ctx, req, hlsStreams, response)
+	storedNames = append(storedNames, streamNames...)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := out.Close(); err != nil {
-		return err
+	succeeded = true
+
+	// audio_file_id/audio_file_url continuam apontando para a primeira faixa
+	response["audio_file_id"] = audioTracks[0]["audio_file_id"]
+	response["audio_file_url"] = audioTracks[0]["audio_file_url"]
+	response["audio_tracks"] = audioTracks
+	response["audio_streams"] = streams
+	// storedNames[1] é a cópia da primeira faixa de áudio
+	recordUpload(req, hashes, outcome.size, response, videoStoredName, storedNames[1])
+	outcome.storedNames = storedNames
+
+	return response, nil
+}
+
+// resolveAudioProfile aplica o perfil padrão quando name está vazio.
+func resolveAudioProfile(name string) (media.AudioProfile, error) {
+	if strings.TrimSpace(name) == "" {
+		name = config.DefaultAudioProfile()
 	}
-	return os.Remove(src)
+	profile, ok := media.LookupAudioProfile(name)
+	if !ok {
+		return media.AudioProfile{}, fmt.Errorf("audio_profile inválido: %s (disponíveis: %s)", name, strings.Join(media.AudioProfileNames(), ", "))
+	}
+	return profile, nil
 }
 
-func saveRemoteFile(body io.Reader, uploadDir, sourcePath string) (string, string, error) {
-	filename, err := generateSafeFilename(filepath.Base(sourcePath))
+// uploadOptionsFromFields lê as opções do pipeline de campos com os nomes de
+// /upload (Upload-Metadata do tus, sessões do navegador). "filename", enviado
+// pelos clientes tus, é o nome padrão no Drive.
+func uploadOptionsFromFields(fields map[string]string) (uploadRequest, error) {
+	audioProfile, err := resolveAudioProfile(fields["audio_profile"])
+	if err != nil {
+		return uploadRequest{}, &requestError{http.StatusBadRequest, err.Error()}
+	}
+	selection, err := parseAudioSelection(fields["audio_stream"], fields["audio_language"])
+	if err != nil {
+		return uploadRequest{}, &requestError{http.StatusBadRequest, err.Error()}
+	}
+	previews, err := parsePreviewOptions(fields["thumbnail"], fields["thumbnail_at"], fields["storyboard"])
 	if err != nil {
-		return "", "", err
+		return uploadRequest{}, err
 	}
+	transcodeOpts, err := parseTranscodeOptions(fields["transcode"], fields["transcode_low"])
+	if err != nil {
+		return uploadRequest{}, err
+	}
+	packageHLS, err := parseFlagField("hls", fields["hls"])
+	if err != nil {
+		return uploadRequest{}, err
+	}
+	reuseDuplicate, err := parseFlagField("dedupe", fields["dedupe"])
+	if err != nil {
+		return uploadRequest{}, err
+	}
+
+	return uploadRequest{
+		folderID:       fields["folder_id"],
+		driveFileName:  cmp.Or(fields["file_name"], fields["filename"]),
+		audioProfile:   audioProfile,
+		audioSelection: selection,
+		previews:       previews,
+		transcode:      transcodeOpts,
+		hls:            packageHLS,
+		dedupe:         reuseDuplicate,
+	}, nil
+}
 
-	filename = ensureUniqueFilename(uploadDir, filename)
-	destPath := filepath.Join(uploadDir, filename)
+// mediaContext limita cada execução do ffmpeg/ffprobe ao FFMPEG_TIMEOUT, além do contexto da requisição ou do job.
+func mediaContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, config.FFmpegTimeout())
+}
 
-	dest, err := os.Create(destPath)
-	if err != nil {
-		return "", "", fmt.Errorf("não foi possível criar arquivo de destino: %w", err)
+func uploadOptions(report jobs.Reporter) services.UploadOptions {
+	opts := services.DefaultUploadOptions()
+	opts.Progress = report.Progress
+	return opts
+}
+
+func respondUploadError(c *gin.Context, err error) {
+	status, message := uploadErrorStatus(err)
+	c.JSON(status, gin.H{"error": message})
+}
+
+// uploadErrorStatus traduz um erro do pipeline no status e na mensagem devolvidos ao cliente.
+func uploadErrorStatus(err error) (int, string) {
+	if errors.Is(err, errUnsupportedMediaType) {
+		return http.StatusBadRequest, "Apenas arquivos de áudio ou vídeo são permitidos"
 	}
+	if errors.Is(err, errInvalidAudioSelection) {
+		return http.StatusBadRequest, err.Error()
+	}
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status, reqErr.message
+	}
+	return http.StatusInternalServerError, err.Error()
+}
 
-	if _, err := io.Copy(dest, body); err != nil {
-		dest.Close()
-		_ = os.Remove(destPath)
-		return "", "", fmt.Errorf("erro ao salvar arquivo baixado: %w", err)
+func bearerToken(c *gin.Context) string {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(c.GetHeader("Authorization")), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
 	}
+	return ""
+}
 
-	if err := dest.Close(); err != nil {
-		_ = os.Remove(destPath)
-		return "", "", fmt.Errorf("erro ao fechar arquivo baixado: %w", err)
+// persistFile grava srcPath no armazenamento, mantendo o nome final em uso
+// em refs desde antes da gravação.
+func persistFile(ctx context.Context, refs *requestRefs, preferredName, srcPath string) (string, error) {
+	name, release, err := storage.Store(ctx, fileStore, fileRefs, preferredName, srcPath)
+	if err != nil {
+		return "", err
 	}
+	refs.hold(release)
+	return name, nil
+}
 
-	return filename, destPath, nil
+func persistGeneratedFile(ctx context.Context, refs *requestRefs, tempPath, preferredName string) (string, error) {
+	filename, err := sanitizeFilename(preferredName)
+	if err != nil {
+		return "", fmt.Errorf("nome de arquivo inválido para áudio: %w", err)
+	}
+	return persistFile(ctx, refs, filename, tempPath)
 }
 
-func generateSafeFilename(preferred string) (string, error) {
-	if preferred != "" {
-		if name, err := sanitizeFilename(preferred); err == nil {
-			return name, nil
-		}
+// createStagingFile cria um arquivo temporário único na área de staging,
+// preservando a extensão de name para que ffmpeg e detecção de MIME funcionem.
+func createStagingFile(name string) (*os.File, error) {
+	dir := config.StagingDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
 	}
-	fallback := fmt.Sprintf("download-%d.tmp", time.Now().Unix())
-	return sanitizeFilename(fallback)
+	return os.CreateTemp(dir, "upload-*"+filepath.Ext(name))
 }
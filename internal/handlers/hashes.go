@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/dedupe"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/services"
+	"upload-drive-script/pkg/logger"
+)
+
+var dedupeIndex *dedupe.Index
+
+// SetDedupeIndex configures the content-addressed index used to record
+// uploads and to answer dedupe=true requests with the existing Drive files.
+func SetDedupeIndex(ix *dedupe.Index) {
+	dedupeIndex = ix
+}
+
+// contentHashes são os hashes do arquivo recebido: SHA-256 identifica o
+// conteúdo no índice e MD5 é comparado com o md5Checksum do Drive.
+type contentHashes struct {
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5"`
+}
+
+// contentHasher calcula os dois hashes em uma única leitura.
+type contentHasher struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func newContentHasher() *contentHasher {
+	return &contentHasher{sha256: sha256.New(), md5: md5.New()}
+}
+
+func (h *contentHasher) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	h.md5.Write(p)
+	return len(p), nil
+}
+
+func (h *contentHasher) sum() *contentHashes {
+	return &contentHashes{
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+	}
+}
+
+// hashFile lê o arquivo inteiro; usado quando os hashes não foram
+// calculados durante o recebimento (URL, tus, sessões do navegador).
+func hashFile(filePath string) (*contentHashes, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hasher := newContentHasher()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return nil, fmt.Errorf("erro ao calcular hash do arquivo: %w", err)
+	}
+	return hasher.sum(), nil
+}
+
+// verifyDriveChecksum confere o md5Checksum do Drive com o arquivo local.
+// Arquivos sem checksum (documentos do Google) não são conferidos.
+func verifyDriveChecksum(ctx context.Context, req uploadRequest, fileID string, hashes *contentHashes) error {
+	if !config.DriveVerifyChecksum() {
+		return nil
+	}
+	info, err := services.GetFileInfo(ctx, req.credentials, fileID)
+	if err != nil {
+		return &requestError{http.StatusBadGateway, fmt.Sprintf("Erro ao conferir checksum no Drive: %v", err)}
+	}
+	if info.Md5Checksum == "" || info.Md5Checksum == hashes.MD5 {
+		return nil
+	}
+	// O arquivo fica no Drive para inspeção; o pipeline não segue com uma cópia divergente
+	logger.Error(fmt.Sprintf("checksum divergente no Drive para %s: md5 %s, esperado %s", fileID, info.Md5Checksum, hashes.MD5))
+	return &requestError{http.StatusBadGateway, "O checksum do arquivo no Drive não confere com o arquivo recebido"}
+}
+
+// duplicateUpload procura um upload anterior do mesmo conteúdo feito pela
+// mesma conta do Drive e na mesma pasta, cujo arquivo no Drive ainda exista e seja acessível com as
+// credenciais do pedido. Só o envio ao Drive é reaproveitado: as derivações
+// pedidas (áudio, prévias, versões web e HLS) são geradas normalmente.
+func duplicateUpload(ctx context.Context, req uploadRequest, hashes *contentHashes) (dedupe.Entry, bool) {
+	if dedupeIndex == nil {
+		return dedupe.Entry{}, false
+	}
+	entry, ok := dedupeIndex.Get(req.credentials.Account(), hashes.SHA256)
+	if !ok || entry.FolderID != req.folderID {
+		return dedupe.Entry{}, false
+	}
+
+	info, err := services.GetFileInfo(ctx, req.credentials, entry.DriveFileID)
+	if err != nil || info.Trashed || (info.Md5Checksum != "" && info.Md5Checksum != hashes.MD5) {
+		if err != nil {
+			logger.Info("upload duplicado ignorado, arquivo do Drive indisponível: " + err.Error())
+		}
+		return dedupe.Entry{}, false
+	}
+
+	logger.Info("upload duplicado de " + hashes.SHA256 + ", reaproveitando " + entry.DriveFileID)
+	return entry, true
+}
+
+// recordUpload registra o upload concluído no índice. Falhas só são logadas:
+// o índice é uma otimização e não invalida o upload.
+func recordUpload(req uploadRequest, hashes *contentHashes, size int64, response gin.H, storedName, audioStoredName string) {
+	// Sem conta conhecida, a entrada não poderia ser reaproveitada com segurança
+	if dedupeIndex == nil || req.credentials.Account() == "" {
+		return
+	}
+	entry := dedupe.Entry{
+		Account:         req.credentials.Account(),
+		SHA256:          hashes.SHA256,
+		MD5:             hashes.MD5,
+		Size:            size,
+		MimeType:        req.mimeType,
+		FolderID:        req.folderID,
+		StoredName:      storedName,
+		AudioStoredName: audioStoredName,
+		CreatedAt:       time.Now(),
+	}
+	if media.IsVideoMime(req.mimeType) {
+		entry.DriveFileID, _ = response["video_file_id"].(string)
+		entry.AudioFileID, _ = response["audio_file_id"].(string)
+	} else {
+		entry.DriveFileID, _ = response["audio_file_id"].(string)
+	}
+	if metadata, err := json.Marshal(response["metadata"]); err == nil {
+		entry.Metadata = metadata
+	}
+	if err := dedupeIndex.Put(entry); err != nil {
+		logger.Error("erro ao registrar upload no índice de duplicados: " + err.Error())
+	}
+}
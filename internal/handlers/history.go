@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/history"
+	"upload-drive-script/pkg/logger"
+)
+
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 500
+)
+
+var historyStore *history.Store
+
+// SetHistoryStore configures where every upload that reaches the pipeline is
+// recorded, and what GET /uploads lists.
+func SetHistoryStore(s *history.Store) {
+	historyStore = s
+}
+
+// uploadSource identifica de onde veio um upload e quem o pediu.
+type uploadSource struct {
+	kind     string
+	url      string
+	user     string
+	apiKeyID string
+}
+
+func requestSource(c *gin.Context, kind string) uploadSource {
+	source := uploadSource{kind: kind}
+	if identity, ok := auth.Identity(c); ok {
+		source.user = identity.Email
+		if source.user == "" {
+			source.user = identity.Subject
+		}
+	}
+	if key, ok := auth.Caller(c); ok {
+		source.apiKeyID = key.ID
+	}
+	return source
+}
+
+// uploadOutcome é preenchido pelo pipeline com o que só ele conhece.
+type uploadOutcome struct {
+	hashes      *contentHashes
+	size        int64
+	storedNames []string
+	duplicate   bool
+}
+
+// recordHistory registra o resultado do pipeline e, em caso de sucesso, devolve
+// o ID do registro em upload_id. Falhas só são logadas: o histórico não invalida o upload.
+func recordHistory(req uploadRequest, outcome *uploadOutcome, startedAt time.Time, response gin.H, err error) {
+	if historyStore == nil {
+		return
+	}
+	record := history.Record{
+		Source:      req.source.kind,
+		SourceURL:   req.source.url,
+		User:        req.source.user,
+		APIKeyID:    req.source.apiKeyID,
+		FileName:    req.driveFileName,
+		FolderID:    req.folderID,
+		MimeType:    req.mimeType,
+		Size:        outcome.size,
+		StoredFiles: outcome.storedNames,
+		Status:      history.StatusSucceeded,
+		Duplicate:   outcome.duplicate,
+		StartedAt:   startedAt,
+		FinishedAt:  time.Now(),
+	}
+	if record.FileName == "" {
+		record.FileName = req.storeName
+	}
+	if outcome.hashes != nil {
+		record.SHA256 = outcome.hashes.SHA256
+		record.MD5 = outcome.hashes.MD5
+	}
+	if err != nil {
+		record.Status = history.StatusFailed
+		_, record.Error = uploadErrorStatus(err)
+	} else {
+		record.VideoFileID, _ = response["video_file_id"].(string)
+		record.AudioFileID, _ = response["audio_file_id"].(string)
+	}
+
+	added, addErr := historyStore.Add(record)
+	if addErr != nil {
+		logger.Error("erro ao registrar upload no histórico: " + addErr.Error())
+		return
+	}
+	if err != nil {
+		logger.Info("upload " + added.ID + " falhou: " + record.Error)
+	} else if response != nil {
+		response["upload_id"] = added.ID
+	}
+}
+
+// ListUploads lista o histórico de uploads, do mais recente ao mais antigo.
+// Aceita os filtros source, status, user, api_key_id, folder_id, mime_type,
+// file_name, sha256, drive_file_id, since e until (RFC 3339), e a paginação
+// por limit e offset.
+func ListUploads(c *gin.Context) {
+	filter := history.Filter{
+		Source:      c.Query("source"),
+		Status:      c.Query("status"),
+		User:        c.Query("user"),
+		APIKeyID:    c.Query("api_key_id"),
+		FolderID:    c.Query("folder_id"),
+		MimeType:    c.Query("mime_type"),
+		FileName:    c.Query("file_name"),
+		SHA256:      c.Query("sha256"),
+		DriveFileID: c.Query("drive_file_id"),
+		Limit:       defaultHistoryPageSize,
+	}
+
+	var err error
+	if filter.Since, err = parseHistoryTime(c.Query("since")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since inválido: use RFC 3339 (ex.: 2025-01-31T12:00:00Z)"})
+		return
+	}
+	if filter.Until, err = parseHistoryTime(c.Query("until")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until inválido: use RFC 3339 (ex.: 2025-01-31T12:00:00Z)"})
+		return
+	}
+	if value := c.Query("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxHistoryPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit deve estar entre 1 e " + strconv.Itoa(maxHistoryPageSize)})
+			return
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		filter.Offset, err = strconv.Atoi(value)
+		if err != nil || filter.Offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset deve ser um número não negativo"})
+			return
+		}
+	}
+
+	records, total, err := historyStore.List(filter)
+	if err != nil {
+		logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao consultar o histórico de uploads"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"uploads": records,
+		"total":   total,
+		"limit":   filter.Limit,
+		"offset":  filter.Offset,
+	})
+}
+
+// GetUploadMeta devolve um registro do histórico. A rota usa :filename porque
+// divide o prefixo com /uploads/:filename.
+func GetUploadMeta(c *gin.Context) {
+	record, ok, err := historyStore.Get(c.Param("filename"))
+	if err != nil {
+		logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao consultar o histórico de uploads"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload não encontrado no histórico"})
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+func parseHistoryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
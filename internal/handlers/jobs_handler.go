@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/services"
+)
+
+var jobManager *jobs.Manager
+
+// SetJobManager configures the worker pool used by asynchronous uploads.
+func SetJobManager(m *jobs.Manager) {
+	jobManager = m
+}
+
+func GetJob(c *gin.Context) {
+	owner, err := requestOwner(c)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	job, ok := jobManager.Get(c.Param("id"))
+	if !ok || !canSeeJob(c, owner, job) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job não encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func ListJobs(c *gin.Context) {
+	owner, err := requestOwner(c)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	visible := []jobs.Job{}
+	for _, job := range jobManager.List() {
+		if canSeeJob(c, owner, job) {
+			visible = append(visible, job)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": visible})
+}
+
+// errUnidentifiedCaller impede jobs sem dono: ninguém além dos admins poderia consultá-los.
+var errUnidentifiedCaller = &requestError{http.StatusUnauthorized, "Não foi possível identificar o solicitante: use uma API key ou credenciais do Drive que identifiquem a conta"}
+
+// jobOwner identifica quem enfileira um job: a API key e a conta do Drive em
+// que as credenciais atuam. Fica vazio quando nenhuma das duas é conhecida.
+func jobOwner(c *gin.Context, credentials services.CredentialProvider) string {
+	var parts []string
+	if key, ok := auth.Caller(c); ok {
+		parts = append(parts, "key:"+key.ID)
+	}
+	if account := credentials.Account(); account != "" {
+		parts = append(parts, account)
+	}
+	return strings.Join(parts, " ")
+}
+
+// requestOwner resolve as credenciais da requisição e devolve o dono dos
+// jobs que ela pode consultar. API keys de escopo admin dispensam a identificação.
+func requestOwner(c *gin.Context) (string, error) {
+	if isAdminCaller(c) {
+		return "", nil
+	}
+	credentials, err := requestCredentials(c)
+	if err != nil {
+		return "", err
+	}
+	owner := jobOwner(c, credentials)
+	if owner == "" {
+		return "", errUnidentifiedCaller
+	}
+	return owner, nil
+}
+
+// canSeeJob libera o job para quem o enviou e para API keys de escopo admin.
+// Jobs de outros usuários, e os sem dono, respondem como inexistentes.
+func canSeeJob(c *gin.Context, owner string, job jobs.Job) bool {
+	if isAdminCaller(c) {
+		return true
+	}
+	return owner != "" && job.Owner == owner
+}
+
+func isAdminCaller(c *gin.Context) bool {
+	key, ok := auth.Caller(c)
+	return ok && key.HasScope(auth.ScopeAdmin)
+}
+
+// submitJob enfileira fn em nome do solicitante. Os erros já vêm no formato
+// de respondUploadError.
+func submitJob(c *gin.Context, credentials services.CredentialProvider, fn jobs.Func) (jobs.Job, error) {
+	owner := jobOwner(c, credentials)
+	if owner == "" {
+		return jobs.Job{}, errUnidentifiedCaller
+	}
+	job, err := jobManager.Submit(owner, fn)
+	if errors.Is(err, jobs.ErrQueueFull) {
+		return job, &requestError{http.StatusServiceUnavailable, "Fila de processamento cheia, tente novamente mais tarde"}
+	}
+	return job, err
+}
+
+// submitUploadJob enfileira o pipeline e responde 202 com o ID do job.
+// O arquivo local é removido se o job falhar ou não puder ser enfileirado.
+func submitUploadJob(c *gin.Context, req uploadRequest) {
+	if !media.IsVideoMime(req.mimeType) && !media.IsAudioMime(req.mimeType) {
+		_ = os.Remove(req.filePath)
+		respondUploadError(c, errUnsupportedMediaType)
+		return
+	}
+
+	job, err := submitJob(c, req.credentials, func(ctx context.Context, report jobs.Reporter) (any, error) {
+		response, err := buildUploadResponse(ctx, req, report)
+		if err != nil {
+			_ = os.Remove(req.filePath)
+			return nil, err
+		}
+		return response, nil
+	})
+	if err != nil {
+		_ = os.Remove(req.filePath)
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": req.publicBaseURL + "/jobs/" + job.ID,
+	})
+}
+
+func wantsAsync(value string) bool {
+	async, err := strconv.ParseBool(strings.TrimSpace(value))
+	return err == nil && async
+}
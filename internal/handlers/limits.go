@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/download"
+	"upload-drive-script/internal/safefetch"
+)
+
+// multipartOverhead é a folga para os campos e delimitadores do formulário
+// na checagem do Content-Length de /upload.
+const multipartOverhead = 1 << 20
+
+var errFileTooLarge = errors.New("arquivo excede o tamanho máximo permitido")
+
+// fileTooLargeError monta a resposta 413 com o limite configurado.
+func fileTooLargeError() *requestError {
+	return &requestError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Arquivo excede o tamanho máximo permitido (%s)", formatBytes(config.MaxFileSize()))}
+}
+
+// downloadError traduz falhas de download remoto nos status devolvidos ao cliente.
+func downloadError(err error) *requestError {
+	var statusErr *download.StatusError
+	switch {
+	case errors.Is(err, download.ErrTooLarge):
+		return fileTooLargeError()
+	case errors.Is(err, safefetch.ErrBlocked):
+		return &requestError{http.StatusBadRequest, "URL não permitida"}
+	case safefetch.IsTimeout(err):
+		return &requestError{http.StatusGatewayTimeout, "Tempo esgotado ao baixar o arquivo"}
+	case errors.As(err, &statusErr):
+		return &requestError{http.StatusBadGateway, fmt.Sprintf("Não foi possível baixar o arquivo (HTTP %d)", statusErr.Code)}
+	default:
+		return &requestError{http.StatusBadGateway, "Não foi possível baixar o arquivo"}
+	}
+}
+
+// limitFileSize envolve r para que a leitura falhe com errFileTooLarge ao
+// passar de MAX_FILE_SIZE.
+func limitFileSize(r io.Reader) io.Reader {
+	limit := config.MaxFileSize()
+	if limit <= 0 {
+		return r
+	}
+	return &sizeLimitedReader{r: r, remaining: limit}
+}
+
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, errFileTooLarge
+	}
+	// Lê um byte além do limite para distinguir "exatamente no limite" de "acima"
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) <= l.remaining {
+		l.remaining -= int64(n)
+		return n, err
+	}
+	n = int(l.remaining)
+	l.remaining = -1
+	return n, errFileTooLarge
+}
+
+// exceedsMaxFileSize checa um tamanho anunciado antes de ler o corpo.
+func exceedsMaxFileSize(size, overhead int64) bool {
+	limit := config.MaxFileSize()
+	return limit > 0 && size > limit+overhead
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
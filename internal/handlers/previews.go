@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/services"
+)
+
+// previewOptions indica quais prévias devem ser geradas para vídeos.
+type previewOptions struct {
+	thumbnail   bool
+	thumbnailAt time.Duration
+	storyboard  bool
+}
+
+// parsePreviewOptions interpreta os campos thumbnail, thumbnail_at e storyboard.
+// thumbnail_at aceita segundos ("12.5") ou uma duração ("1m30s") e implica thumbnail=true.
+func parsePreviewOptions(thumbnail, thumbnailAt, storyboard string) (previewOptions, error) {
+	opts := previewOptions{thumbnailAt: config.ThumbnailAt()}
+
+	var err error
+	if opts.thumbnail, err = parseFlagField("thumbnail", thumbnail); err != nil {
+		return opts, err
+	}
+	if opts.storyboard, err = parseFlagField("storyboard", storyboard); err != nil {
+		return opts, err
+	}
+
+	thumbnailAt = strings.TrimSpace(thumbnailAt)
+	if thumbnailAt != "" {
+		at, err := parseTimestamp(thumbnailAt)
+		if err != nil {
+			return opts, &requestError{http.StatusBadRequest, "thumbnail_at inválido: use segundos (ex.: 12.5) ou uma duração (ex.: 1m30s)"}
+		}
+		opts.thumbnail = true
+		opts.thumbnailAt = at
+	}
+
+	return opts, nil
+}
+
+func parseFlagField(name, value string) (bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, &requestError{http.StatusBadRequest, name + " deve ser true ou false"}
+	}
+	return parsed, nil
+}
+
+func parseTimestamp(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0, strconv.ErrRange
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	at, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if at < 0 {
+		return 0, strconv.ErrRange
+	}
+	return at, nil
+}
+
+// generatedFile é um arquivo derivado do vídeo, já enviado ao Drive e
+// aguardando ser gravado no armazenamento.
+type generatedFile struct {
+	tempPath  string
+	driveName string
+	fileID    string
+}
+
+type generatedPreviews struct {
+	thumbnail  *generatedFile
+	storyboard *generatedFile
+	sprite     *media.Storyboard
+}
+
+func (p *generatedPreviews) cleanup() {
+	if p.thumbnail != nil {
+		_ = os.Remove(p.thumbnail.tempPath)
+	}
+	if p.storyboard != nil {
+		_ = os.Remove(p.storyboard.tempPath)
+	}
+}
+
+// generatePreviews gera e envia ao Drive o thumbnail e o storyboard pedidos.
+// Os arquivos temporários devem ser removidos pelo chamador com cleanup, mesmo em erro.
+func generatePreviews(ctx context.Context, req uploadRequest, metadata *media.Metadata, report jobs.Reporter) (*generatedPreviews, error) {
+	previews := &generatedPreviews{}
+	if !req.previews.thumbnail && !req.previews.storyboard {
+		return previews, nil
+	}
+
+	report.Stage(jobs.StagePreview)
+
+	if req.previews.thumbnail {
+		mediaCtx, cancel := mediaContext(ctx)
+		tempPath, err := media.GenerateThumbnail(mediaCtx, req.filePath, req.previews.thumbnailAt, metadata)
+		cancel()
+		if err != nil {
+			return previews, err
+		}
+		previews.thumbnail = &generatedFile{
+			tempPath:  tempPath,
+			driveName: media.BuildDerivedFileName(req.driveFileName, req.storeName, "-thumbnail", ".jpg"),
+		}
+		if previews.thumbnail.fileID, err = services.UploadFile(ctx, req.credentials, tempPath, req.folderID, previews.thumbnail.driveName, uploadOptions(report)); err != nil {
+			return previews, err
+		}
+	}
+
+	if req.previews.storyboard {
+		mediaCtx, cancel := mediaContext(ctx)
+		sprite, err := media.GenerateStoryboard(mediaCtx, req.filePath, metadata, media.StoryboardOptions{
+			Interval:  config.StoryboardInterval(),
+			Columns:   config.StoryboardColumns(),
+			TileWidth: config.StoryboardTileWidth(),
+		})
+		cancel()
+		if err != nil {
+			return previews, err
+		}
+		previews.sprite = sprite
+		previews.storyboard = &generatedFile{
+			tempPath:  sprite.Path,
+			driveName: media.BuildDerivedFileName(req.driveFileName, req.storeName, "-storyboard", ".jpg"),
+		}
+		if previews.storyboard.fileID, err = services.UploadFile(ctx, req.credentials, sprite.Path, req.folderID, previews.storyboard.driveName, uploadOptions(report)); err != nil {
+			return previews, err
+		}
+	}
+
+	return previews, nil
+}
+
+// storePreviews grava as prévias no armazenamento e preenche a resposta.
+// O índice WebVTT só é gerado aqui, pois aponta para a URL final do sprite.
+// Retorna os nomes gravados, inclusive em caso de erro, para que o chamador possa desfazer.
+func storePreviews(ctx context.Context, req uploadRequest, previews *generatedPreviews, response gin.H) ([]string, error) {
+	var storedNames []string
+
+	if previews.thumbnail != nil {
+		storedName, err := persistGeneratedFile(ctx, req.refs, previews.thumbnail.tempPath, previews.thumbnail.driveName)
+		if err != nil {
+			return storedNames, err
+		}
+		storedNames = append(storedNames, storedName)
+		response["thumbnail_file_id"] = previews.thumbnail.fileID
+		response["thumbnail_file_url"] = buildPublicFileURL(req.publicBaseURL, storedName)
+	}
+
+	if previews.storyboard == nil {
+		return storedNames, nil
+	}
+
+	spriteName, err := persistGeneratedFile(ctx, req.refs, previews.storyboard.tempPath, previews.storyboard.driveName)
+	if err != nil {
+		return storedNames, err
+	}
+	storedNames = append(storedNames, spriteName)
+	spriteURL := buildPublicFileURL(req.publicBaseURL, spriteName)
+
+	// O índice referencia o sprite pelo nome, relativo a /uploads, para não
+	// depender do host nem de uma assinatura que expira; serveStoryboardVTT
+	// assina a referência a cada entrega. ":" é escapado para não virar esquema
+	spriteRef := strings.ReplaceAll(url.PathEscape(spriteName), ":", "%3A")
+
+	vtt, err := createStagingFile("storyboard.vtt")
+	if err != nil {
+		return storedNames, err
+	}
+	vttPath := vtt.Name()
+	defer os.Remove(vttPath)
+
+	_, err = vtt.WriteString(previews.sprite.WebVTT(spriteRef))
+	vtt.Close()
+	if err != nil {
+		return storedNames, err
+	}
+
+	vttDriveName := media.BuildDerivedFileName(req.driveFileName, req.storeName, "-storyboard", ".vtt")
+	vttFileID, err := services.UploadFile(ctx, req.credentials, vttPath, req.folderID, vttDriveName, services.DefaultUploadOptions())
+	if err != nil {
+		return storedNames, err
+	}
+
+	vttName, err := persistGeneratedFile(ctx, req.refs, vttPath, vttDriveName)
+	if err != nil {
+		return storedNames, err
+	}
+	storedNames = append(storedNames, vttName)
+
+	response["storyboard_file_id"] = previews.storyboard.fileID
+	response["storyboard_file_url"] = spriteURL
+	response["storyboard_vtt_file_id"] = vttFileID
+	response["storyboard_vtt_url"] = buildPublicFileURL(req.publicBaseURL, vttName)
+
+	return storedNames, nil
+}
+
+// storyboardCuePattern reconhece as referências relativas ao sprite escritas
+// por Storyboard.WebVTT, como "video-storyboard.jpg#xywh=0,0,160,90".
+var storyboardCuePattern = regexp.MustCompile(`(?m)^([^\s/?#:]+)(#xywh=\d+,\d+,\d+,\d+)$`)
+
+// serveStoryboardVTT entrega um índice WebVTT com a referência ao sprite
+// assinada, pois o player não repassa a assinatura do índice ao buscar a imagem.
+func serveStoryboardVTT(c *gin.Context, name string) {
+	release := fileRefs.Acquire(name)
+	defer release()
+
+	content, ok := readStoredText(c, name)
+	if !ok {
+		return
+	}
+
+	expires := time.Now().Add(config.SignedURLTTL())
+	content = storyboardCuePattern.ReplaceAllStringFunc(content, func(cue string) string {
+		match := storyboardCuePattern.FindStringSubmatch(cue)
+		spriteName, err := url.PathUnescape(match[1])
+		if err != nil {
+			return cue
+		}
+		if spriteName, err = sanitizeFilename(spriteName); err != nil {
+			return cue
+		}
+		return match[1] + "?" + urlSigner.Sign(uploadResource(spriteName), expires).Encode() + match[2]
+	})
+	c.Data(http.StatusOK, "text/vtt; charset=utf-8", []byte(content))
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/media"
+)
+
+// Probe aceita as mesmas entradas de /upload (parte "file") e /upload-url
+// (campo "url") e devolve apenas os metadados, sem enviar nada ao Drive.
+func Probe(c *gin.Context) {
+	var fileName string
+	var filePath string
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if exceedsMaxFileSize(c.Request.ContentLength, multipartOverhead) {
+			respondUploadError(c, fileTooLargeError())
+			return
+		}
+		name, path, err := receiveProbeMultipart(c)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		fileName, filePath = name, path
+	} else {
+		fileURL := c.PostForm("url")
+		if fileURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nenhum arquivo ou URL fornecido"})
+			return
+		}
+		name, path, err := fetchRemoteFile(c.Request.Context(), fileURL)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		fileName, filePath = name, path
+	}
+	defer os.Remove(filePath)
+
+	if err := auth.FinishBody(c.Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mimeType, err := media.DetectMimeType(filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !media.IsVideoMime(mimeType) && !media.IsAudioMime(mimeType) {
+		respondUploadError(c, errUnsupportedMediaType)
+		return
+	}
+
+	mediaCtx, cancel := mediaContext(c.Request.Context())
+	defer cancel()
+	metadata, err := media.Probe(mediaCtx, filePath)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_name": fileName,
+		"mime_type": mimeType,
+		"metadata":  metadata,
+	})
+}
+
+// receiveProbeMultipart grava a parte "file" (ou baixa o campo "url") na área de staging.
+func receiveProbeMultipart(c *gin.Context) (string, string, error) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return "", "", &requestError{http.StatusBadRequest, "Falha ao ler multipart request"}
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", "", &requestError{http.StatusBadRequest, "Erro ao ler parte do formulário"}
+		}
+
+		switch part.FormName() {
+		case "url":
+			buf := new(strings.Builder)
+			if _, err := io.Copy(buf, part); err != nil {
+				return "", "", &requestError{http.StatusInternalServerError, "Erro ao ler url"}
+			}
+			if err := auth.FinishBody(c.Request); err != nil {
+				return "", "", &requestError{http.StatusBadRequest, err.Error()}
+			}
+			return fetchRemoteFile(c.Request.Context(), buf.String())
+		case "file":
+			cleanName, err := sanitizeFilename(part.FileName())
+			if err != nil {
+				return "", "", &requestError{http.StatusBadRequest, err.Error()}
+			}
+			out, err := createStagingFile(cleanName)
+			if err != nil {
+				return "", "", &requestError{http.StatusInternalServerError, "Falha ao criar arquivo local"}
+			}
+			_, err = io.Copy(out, limitFileSize(part))
+			out.Close()
+			if errors.Is(err, errFileTooLarge) {
+				_ = os.Remove(out.Name())
+				return "", "", fileTooLargeError()
+			} else if err != nil {
+				_ = os.Remove(out.Name())
+				return "", "", &requestError{http.StatusInternalServerError, "Erro ao salvar arquivo local"}
+			}
+			return cleanName, out.Name(), nil
+		}
+	}
+
+	return "", "", &requestError{http.StatusBadRequest, "Nenhum arquivo ou URL fornecido"}
+}
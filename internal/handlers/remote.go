@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/download"
+	"upload-drive-script/internal/resolver"
+	"upload-drive-script/internal/safefetch"
+	"upload-drive-script/pkg/logger"
+)
+
+// requestError carrega o status HTTP e a mensagem que devem ser devolvidos ao cliente.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+// remoteDownloader baixa as URLs enviadas pelos clientes; sem
+// SetRemoteDownloader valem apenas os bloqueios padrão de endereços internos.
+var remoteDownloader = &download.Downloader{
+	Client: safefetch.NewClient(&safefetch.Policy{}, safefetch.Timeouts{
+		Connect: 10 * time.Second,
+		Header:  30 * time.Second,
+		Idle:    time.Minute,
+	}),
+	Dir:         config.DownloadDir(),
+	MaxSize:     config.MaxFileSize(),
+	Connections: 1,
+}
+
+// remotePolicy é aplicada às URLs antes dos resolvers, que podem acessar a
+// página por conta própria (o extrator roda fora do cliente do remoteDownloader).
+var remotePolicy = &safefetch.Policy{}
+
+// SetRemotePolicy configures the policy checked before URLs are resolved;
+// it should be the same one given to the remote downloader's client.
+func SetRemotePolicy(p *safefetch.Policy) {
+	remotePolicy = p
+}
+
+// urlResolvers converte links de compartilhamento e páginas de vídeo em
+// URLs diretas antes do download.
+var urlResolvers = resolver.Default()
+
+// SetURLResolvers configures the resolvers tried before each remote download.
+func SetURLResolvers(r *resolver.Registry) {
+	urlResolvers = r
+}
+
+// SetRemoteDownloader configures the downloader used by /upload-url and
+// /probe; its client is normally built with safefetch.NewClient.
+func SetRemoteDownloader(d *download.Downloader) {
+	remoteDownloader = d
+}
+
+// fetchRemoteFile valida rawURL, baixa o conteúdo para a área de staging e
+// retorna o nome preferido para o armazenamento e o caminho do arquivo baixado.
+func fetchRemoteFile(ctx context.Context, rawURL string) (string, string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return "", "", &requestError{http.StatusBadRequest, "URL inválida"}
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return "", "", &requestError{http.StatusBadRequest, "Apenas URLs HTTP/HTTPS são permitidas"}
+	}
+
+	if err := remotePolicy.CheckHost(ctx, parsedURL); err != nil {
+		return "", "", downloadError(err)
+	}
+	source, err := urlResolvers.Resolve(ctx, parsedURL)
+	if err != nil {
+		logger.Info("resolver URL remota: " + err.Error())
+		return "", "", &requestError{http.StatusUnprocessableEntity, "Não foi possível obter o arquivo a partir da URL: " + err.Error()}
+	}
+	// A URL resolvida também passa pela política antes do download
+	if err := remotePolicy.CheckURL(source.URL); err != nil {
+		return "", "", downloadError(err)
+	}
+
+	file, err := remoteDownloader.Fetch(ctx, download.Request{URL: source.URL, Header: source.Header})
+	if err != nil {
+		logger.Info("download remoto falhou: " + err.Error())
+		return "", "", downloadError(err)
+	}
+
+	return moveDownloadedFile(file, remoteFileName(source, file))
+}
+
+// remoteFileName escolhe o nome do download: o sugerido pelo resolver, o do
+// Content-Disposition da origem ou o último segmento da URL final.
+func remoteFileName(source *resolver.Source, file *download.File) string {
+	if source.FileName != "" {
+		return source.FileName
+	}
+	if _, params, err := mime.ParseMediaType(file.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	if file.FinalURL == nil {
+		return path.Base(source.URL.Path)
+	}
+	return path.Base(file.FinalURL.Path)
+}
+
+// moveDownloadedFile leva o download concluído para a área de staging, com a
+// extensão do nome preferido.
+func moveDownloadedFile(file *download.File, preferredName string) (string, string, error) {
+	return moveToStaging(file.Path, preferredName)
+}
+
+// moveToStaging move src para a área de staging; src deixa de existir mesmo
+// em caso de erro.
+func moveToStaging(src, preferredName string) (string, string, error) {
+	defer os.Remove(src)
+
+	filename, err := generateSafeFilename(filepath.Base(preferredName))
+	if err != nil {
+		return "", "", err
+	}
+
+	dest, err := createStagingFile(filename)
+	if err != nil {
+		return "", "", fmt.Errorf("não foi possível criar arquivo de destino: %w", err)
+	}
+	destPath := dest.Name()
+	dest.Close()
+
+	if err := os.Rename(src, destPath); err == nil {
+		return filename, destPath, nil
+	}
+
+	// Diretórios em volumes diferentes: copia
+	if err := copyFile(src, destPath); err != nil {
+		_ = os.Remove(destPath)
+		return "", "", fmt.Errorf("erro ao salvar arquivo baixado: %w", err)
+	}
+	return filename, destPath, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func generateSafeFilename(preferred string) (string, error) {
+	if preferred != "" {
+		if name, err := sanitizeFilename(preferred); err == nil {
+			return name, nil
+		}
+	}
+	fallback := fmt.Sprintf("download-%d.tmp", time.Now().Unix())
+	return sanitizeFilename(fallback)
+}
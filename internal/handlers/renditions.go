@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/services"
+)
+
+// transcodeOptions indica quais versões web (H.264/AAC em MP4) devem ser geradas.
+type transcodeOptions struct {
+	enabled bool
+	lowRes  bool
+}
+
+// parseTranscodeOptions interpreta os campos transcode e transcode_low;
+// transcode_low=true implica transcode=true.
+func parseTranscodeOptions(transcode, transcodeLow string) (transcodeOptions, error) {
+	var opts transcodeOptions
+	var err error
+	if opts.enabled, err = parseFlagField("transcode", transcode); err != nil {
+		return opts, err
+	}
+	if opts.lowRes, err = parseFlagField("transcode_low", transcodeLow); err != nil {
+		return opts, err
+	}
+	opts.enabled = opts.enabled || opts.lowRes
+	return opts, nil
+}
+
+type generatedRendition struct {
+	generatedFile
+	name   string
+	height int // 0 quando desconhecida
+}
+
+func removeRenditionFiles(renditions []generatedRendition) {
+	for _, rendition := range renditions {
+		_ = os.Remove(rendition.tempPath)
+	}
+}
+
+// generateRenditions converte o vídeo e envia cada versão ao Drive.
+// A versão reduzida é omitida quando o original já não é maior que ela.
+// Os arquivos temporários devem ser removidos pelo chamador, mesmo em erro.
+func generateRenditions(ctx context.Context, req uploadRequest, metadata *media.Metadata, report jobs.Reporter) ([]generatedRendition, error) {
+	if !req.transcode.enabled {
+		return nil, nil
+	}
+
+	sourceHeight := 0
+	if metadata != nil && metadata.Video != nil {
+		sourceHeight = metadata.Video.Height
+	}
+
+	type target struct {
+		name      string
+		maxHeight int
+	}
+	targets := []target{{name: "web"}}
+	if lowHeight := config.TranscodeLowHeight(); req.transcode.lowRes && lowHeight > 0 && (sourceHeight == 0 || sourceHeight > lowHeight) {
+		targets = append(targets, target{name: strconv.Itoa(lowHeight) + "p", maxHeight: lowHeight})
+	}
+
+	var renditions []generatedRendition
+	for _, t := range targets {
+		report.Stage(jobs.StageTranscode)
+		mediaCtx, cancel := mediaContext(ctx)
+		tempPath, err := media.TranscodeMP4(mediaCtx, req.filePath, media.TranscodeOptions{
+			MaxHeight: t.maxHeight,
+			Preset:    config.TranscodePreset(),
+			CRF:       config.TranscodeCRF(),
+		})
+		cancel()
+		if err != nil {
+			return renditions, err
+		}
+
+		height := sourceHeight
+		if t.maxHeight > 0 {
+			height = t.maxHeight
+		}
+		rendition := generatedRendition{
+			generatedFile: generatedFile{
+				tempPath:  tempPath,
+				driveName: media.BuildDerivedFileName(req.driveFileName, req.storeName, "-"+t.name, ".mp4"),
+			},
+			name:   t.name,
+			height: height,
+		}
+		renditions = append(renditions, rendition)
+
+		fileID, err := services.UploadFile(ctx, req.credentials, tempPath, req.folderID, rendition.driveName, uploadOptions(report))
+		if err != nil {
+			return renditions, err
+		}
+		renditions[len(renditions)-1].fileID = fileID
+	}
+
+	return renditions, nil
+}
+
+// storeRenditions grava as versões no armazenamento e preenche response["renditions"].
+// Retorna os nomes gravados, inclusive em caso de erro, para que o chamador possa desfazer.
+func storeRenditions(ctx context.Context, req uploadRequest, renditions []generatedRendition, response gin.H) ([]string, error) {
+	if len(renditions) == 0 {
+		return nil, nil
+	}
+
+	var storedNames []string
+	entries := make([]gin.H, 0, len(renditions))
+	for _, rendition := range renditions {
+		storedName, err := persistGeneratedFile(ctx, req.refs, rendition.tempPath, rendition.driveName)
+		if err != nil {
+			return storedNames, err
+		}
+		storedNames = append(storedNames, storedName)
+
+		entry := gin.H{
+			"name":     rendition.name,
+			"height":   nil,
+			"file_id":  rendition.fileID,
+			"file_url": buildPublicFileURL(req.publicBaseURL, storedName),
+		}
+		if rendition.height > 0 {
+			entry["height"] = rendition.height
+		}
+		entries = append(entries, entry)
+	}
+
+	response["renditions"] = entries
+	return storedNames, nil
+}
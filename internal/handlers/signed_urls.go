@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/storage"
+	"upload-drive-script/internal/urlsign"
+)
+
+var urlSigner *urlsign.Signer
+
+// SetURLSigner configures the signer for the /uploads and /streams URLs. A
+// nil signer leaves the URLs unsigned.
+func SetURLSigner(s *urlsign.Signer) {
+	urlSigner = s
+}
+
+// uploadResource é o que a assinatura vincula: o caminho do arquivo, sem o host,
+// para que a URL continue válida atrás de proxies.
+func uploadResource(filename string) string {
+	return "uploads/" + filename
+}
+
+// signedFileURL monta a URL pública de filename, assinada por ttl quando há signer.
+func signedFileURL(baseURL, filename string, ttl time.Duration) (string, time.Time) {
+	fileURL := baseURL + "/uploads/" + url.PathEscape(filename)
+	if urlSigner == nil {
+		return fileURL, time.Time{}
+	}
+	expires := time.Now().Add(ttl)
+	return fileURL + "?" + urlSigner.Sign(uploadResource(filename), expires).Encode(), expires
+}
+
+// streamResource vincula a assinatura ao pacote HLS inteiro: a playlist
+// referencia os segmentos por caminho relativo.
+func streamResource(id string) string {
+	return streamsPrefix + "/" + id + "/"
+}
+
+// signedStreamURL monta a URL da playlist do pacote id, assinada por ttl quando há signer.
+func signedStreamURL(baseURL, id string, ttl time.Duration) string {
+	streamURL := baseURL + "/" + path.Join(streamsPrefix, id, media.HLSPlaylistName)
+	if urlSigner == nil {
+		return streamURL
+	}
+	return streamURL + "?" + urlSigner.Sign(streamResource(id), time.Now().Add(ttl)).Encode()
+}
+
+// signatureQuery devolve só os parâmetros de assinatura da requisição.
+func signatureQuery(c *gin.Context) string {
+	return url.Values{
+		urlsign.ExpiresParam:   {c.Query(urlsign.ExpiresParam)},
+		urlsign.SignatureParam: {c.Query(urlsign.SignatureParam)},
+	}.Encode()
+}
+
+// RequireUploadAccess lets GET /uploads requests with a valid signature
+// through. Unsigned requests are rejected when SIGNED_URL_REQUIRED is set and
+// otherwise handed to fallback, usually the API key check.
+func RequireUploadAccess(fallback gin.HandlerFunc) gin.HandlerFunc {
+	return requireSignedAccess(func(c *gin.Context) (string, bool) {
+		fileName, err := sanitizeFilename(c.Param("filename"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Nome de arquivo inválido"})
+			return "", false
+		}
+		return uploadResource(fileName), true
+	}, fallback)
+}
+
+// RequireStreamAccess applies the same rules to /streams. One signature
+// covers every playlist and segment of a package.
+func RequireStreamAccess(fallback gin.HandlerFunc) gin.HandlerFunc {
+	return requireSignedAccess(func(c *gin.Context) (string, bool) {
+		id := c.Param("id")
+		if !streamIDPattern.MatchString(id) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+			return "", false
+		}
+		return streamResource(id), true
+	}, fallback)
+}
+
+// requireSignedAccess confere a assinatura do recurso devolvido por resource,
+// que responde por conta própria quando o caminho é inválido.
+func requireSignedAccess(resource func(*gin.Context) (string, bool), fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if urlSigner != nil {
+			name, ok := resource(c)
+			if !ok {
+				return
+			}
+
+			err := urlSigner.Verify(name, c.Request.URL.Query(), time.Now())
+			switch {
+			case err == nil:
+				c.Next()
+				return
+			case !errors.Is(err, urlsign.ErrMissingSignature):
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			case config.SignedURLRequired():
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "É necessária uma URL assinada para acessar este arquivo"})
+				return
+			}
+		}
+
+		fallback(c)
+	}
+}
+
+// RequireSignPermission restricts minting URLs to authenticated API keys
+// (already scope-checked by RequireAPIKey) or, without API keys, to the
+// ADMIN_API_TOKEN holder.
+func RequireSignPermission() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := auth.Caller(c); ok {
+			c.Next()
+			return
+		}
+		requireAdminToken(c)
+	}
+}
+
+// SignUploadedFile mints a fresh signed URL for a stored file. The optional
+// expires_in field takes a Go duration ("30m") or seconds, up to
+// SIGNED_URL_MAX_TTL.
+func SignUploadedFile(c *gin.Context) {
+	if urlSigner == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Assinatura de URLs desabilitada (SIGNED_URL_SECRET não configurado)"})
+		return
+	}
+
+	fileName, err := sanitizeFilename(c.Param("filename"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome de arquivo inválido"})
+		return
+	}
+
+	expiresIn := c.PostForm("expires_in")
+	if err := auth.FinishBody(c.Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if expiresIn == "" {
+		expiresIn = c.Query("expires_in")
+	}
+	ttl, err := parseExpiresIn(expiresIn)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := fileStore.Stat(c.Request.Context(), fileName); errors.Is(err, storage.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao acessar arquivo"})
+		return
+	}
+
+	fileURL, expires := signedFileURL(publicBaseURL(c), fileName, ttl)
+	c.JSON(http.StatusOK, gin.H{
+		"file_url":   fileURL,
+		"expires_at": expires.UTC().Format(time.RFC3339),
+	})
+}
+
+func parseExpiresIn(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return config.SignedURLTTL(), nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, errors.New("expires_in inválido (use segundos ou uma duração como 30m)")
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 {
+		return 0, errors.New("expires_in deve ser positivo")
+	}
+	if maxTTL := config.SignedURLMaxTTL(); ttl > maxTTL {
+		return 0, errors.New("expires_in acima do máximo permitido (" + maxTTL.String() + ")")
+	}
+	return ttl, nil
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/storage"
+	"upload-drive-script/internal/urlsign"
+)
+
+// streamsPrefix é o diretório do armazenamento onde ficam os pacotes HLS.
+const streamsPrefix = storage.StreamsPrefix
+
+var streamIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+var streamContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+// GetStreamFile serves the playlists and segments of an HLS package.
+func GetStreamFile(c *gin.Context) {
+	id := c.Param("id")
+	file := strings.TrimPrefix(c.Param("file"), "/")
+	if !streamIDPattern.MatchString(id) || file == "" || strings.Contains(file, "/") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return
+	}
+
+	contentType, ok := streamContentTypes[path.Ext(file)]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return
+	}
+
+	name := path.Join(streamsPrefix, id, file)
+	c.Header("Content-Type", contentType)
+	if path.Ext(file) != ".m3u8" {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		serveStoredFile(c, name)
+		return
+	}
+
+	// Playlists VOD não mudam, mas um cache curto permite remover o pacote sem prender clientes
+	c.Header("Cache-Control", "public, max-age=300")
+	if urlSigner == nil || c.Query(urlsign.SignatureParam) == "" {
+		serveStoredFile(c, name)
+		return
+	}
+
+	// RequireStreamAccess já validou a assinatura, que vale para todo o pacote:
+	// os segmentos recebem a mesma query, pois o player não a repassa sozinho
+	release := fileRefs.Acquire(name)
+	defer release()
+	playlist, ok := readStoredText(c, name)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, contentType, []byte(signPlaylistURIs(playlist, signatureQuery(c))))
+}
+
+// signPlaylistURIs acrescenta query às linhas de URI de uma playlist HLS.
+func signPlaylistURIs(playlist, query string) string {
+	lines := strings.Split(playlist, "\n")
+	for i, line := range lines {
+		uri := strings.TrimSpace(line)
+		if uri == "" || strings.HasPrefix(uri, "#") {
+			continue
+		}
+		separator := "?"
+		if strings.Contains(uri, "?") {
+			separator = "&"
+		}
+		lines[i] = uri + separator + query
+	}
+	return strings.Join(lines, "\n")
+}
+
+// generatedStreams guarda os pacotes HLS gerados na área de staging,
+// aguardando serem gravados no armazenamento.
+type generatedStreams struct {
+	videoDir string
+	audioDir string
+}
+
+func (s *generatedStreams) cleanup() {
+	if s.videoDir != "" {
+		_ = os.RemoveAll(s.videoDir)
+	}
+	if s.audioDir != "" {
+		_ = os.RemoveAll(s.audioDir)
+	}
+}
+
+// generateStreams empacota em HLS o vídeo (videoPath) e o áudio (audioPath).
+// Caminhos vazios são ignorados; audioMeta pode ser nil quando o áudio foi
+// gerado pelo próprio pipeline. Os diretórios devem ser removidos com cleanup, mesmo em erro.
+func generateStreams(ctx context.Context, req uploadRequest, videoPath string, videoMeta *media.Metadata, audioPath string, audioMeta *media.Metadata, report jobs.Reporter) (*generatedStreams, error) {
+	streams := &generatedStreams{}
+	if !req.hls {
+		return streams, nil
+	}
+
+	report.Stage(jobs.StageHLSPackage)
+
+	var err error
+	if videoPath != "" {
+		if streams.videoDir, err = packageHLS(ctx, videoPath, videoMeta, false); err != nil {
+			return streams, err
+		}
+	}
+	if audioPath != "" {
+		if streams.audioDir, err = packageHLS(ctx, audioPath, audioMeta, true); err != nil {
+			return streams, err
+		}
+	}
+	return streams, nil
+}
+
+func packageHLS(ctx context.Context, srcPath string, meta *media.Metadata, audioOnly bool) (string, error) {
+	if err := os.MkdirAll(config.StagingDir(), 0o755); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(config.StagingDir(), "hls-*")
+	if err != nil {
+		return "", err
+	}
+
+	mediaCtx, cancel := mediaContext(ctx)
+	defer cancel()
+	err = media.PackageHLS(mediaCtx, srcPath, dir, meta, media.HLSOptions{
+		SegmentDuration: config.HLSSegmentDuration(),
+		AudioOnly:       audioOnly,
+		Preset:          config.TranscodePreset(),
+	})
+	return dir, err
+}
+
+// storeStreams grava os pacotes HLS em streams/<id>/ e preenche
+// video_stream_url/audio_stream_url. Retorna os nomes gravados, inclusive em
+// caso de erro, para que o chamador possa desfazer.
+func storeStreams(ctx context.Context, req uploadRequest, streams *generatedStreams, response gin.H) ([]string, error) {
+	var storedNames []string
+	for _, entry := range []struct {
+		dir   string
+		field string
+	}{
+		{streams.videoDir, "video_stream_url"},
+		{streams.audioDir, "audio_stream_url"},
+	} {
+		if entry.dir == "" {
+			continue
+		}
+
+		id, err := newStreamID()
+		if err != nil {
+			return storedNames, err
+		}
+		// O pacote fica em uso desde antes da gravação, para o janitor não removê-lo pela metade
+		req.refs.acquire(path.Join(streamsPrefix, id))
+		names, err := storage.StoreTree(ctx, fileStore, path.Join(streamsPrefix, id), entry.dir)
+		storedNames = append(storedNames, names...)
+		if err != nil {
+			return storedNames, err
+		}
+		response[entry.field] = signedStreamURL(req.publicBaseURL, id, config.SignedURLTTL())
+	}
+	return storedNames, nil
+}
+
+func newStreamID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("gerar ID do stream: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/history"
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/tus"
+	"upload-drive-script/pkg/logger"
+)
+
+// tusExtensions são as extensões do protocolo anunciadas em OPTIONS.
+const tusExtensions = "creation,termination,expiration"
+
+var tusStore *tus.Store
+
+// SetTusStore configures where tus uploads are kept while they are received.
+func SetTusStore(s *tus.Store) {
+	tusStore = s
+}
+
+// TusResumable exige Tus-Resumable: 1.0.0 (exceto em OPTIONS) e o devolve
+// em todas as respostas.
+func TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tus.Version)
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tus.Version {
+			c.Header("Tus-Version", tus.Version)
+			c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": "Versão do protocolo tus não suportada"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Version", tus.Version)
+	c.Header("Tus-Extension", tusExtensions)
+	if limit := config.MaxFileSize(); limit > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(limit, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TusCreate implementa a extensão creation. As opções do pipeline vêm em
+// Upload-Metadata, com os mesmos nomes dos campos de /upload.
+func TusCreate(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length ausente ou inválido"})
+		return
+	}
+	if exceedsMaxFileSize(length, 0) {
+		respondUploadError(c, fileTooLargeError())
+		return
+	}
+
+	metadata, err := tus.ParseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Opções inválidas são recusadas antes de o cliente enviar o arquivo
+	if _, err := uploadOptionsFromFields(metadata); err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if err := auth.FinishBody(c.Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := tusStore.Create(length, metadata)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar upload: " + err.Error()})
+		return
+	}
+
+	c.Header("Location", publicBaseURL(c)+"/tus/"+info.ID)
+	setTusHeaders(c, info)
+	c.Status(http.StatusCreated)
+}
+
+func TusHead(c *gin.Context) {
+	info, err := tusStore.Get(c.Param("id"))
+	if err != nil {
+		respondTusError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Length", strconv.FormatInt(info.Length, 10))
+	if len(info.Metadata) > 0 {
+		c.Header("Upload-Metadata", tus.EncodeMetadata(info.Metadata))
+	}
+	setTusHeaders(c, info)
+	c.Status(http.StatusOK)
+}
+
+// TusPatch grava um trecho do arquivo. Quando o último byte chega, o arquivo
+// vira um job do pipeline de /upload; o ID vem em Upload-Job-Id.
+func TusPatch(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type deve ser application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset ausente ou inválido"})
+		return
+	}
+
+	id := c.Param("id")
+	unlock, err := tusStore.Lock(id)
+	if err != nil {
+		respondTusError(c, err)
+		return
+	}
+	defer unlock()
+
+	info, err := tusStore.Get(id)
+	if err != nil {
+		respondTusError(c, err)
+		return
+	}
+	if offset != info.Offset {
+		respondTusError(c, tus.ErrOffsetMismatch)
+		return
+	}
+
+	info, err = tusStore.Write(id, offset, c.Request.Body)
+	if auth.PendingBodyHash(c.Request) {
+		// Trechos assinados só valem inteiros: sem o hash conferido, nada é mantido
+		if err == nil {
+			err = auth.FinishBody(c.Request)
+		}
+		if err != nil && info.Offset > offset {
+			if truncErr := tusStore.Truncate(id, offset); truncErr != nil {
+				logger.Error("descartar trecho tus: " + truncErr.Error())
+			}
+			info.Offset = offset
+		}
+	}
+	if err != nil {
+		setTusHeaders(c, info)
+		respondTusError(c, err)
+		return
+	}
+
+	if info.Complete() && info.JobID == "" {
+		if info, err = handOffTusUpload(c, info); err != nil {
+			setTusHeaders(c, info)
+			respondUploadError(c, err)
+			return
+		}
+	}
+
+	setTusHeaders(c, info)
+	c.Status(http.StatusNoContent)
+}
+
+// TusDelete implementa a extensão termination.
+func TusDelete(c *gin.Context) {
+	id := c.Param("id")
+	unlock, err := tusStore.Lock(id)
+	if err != nil {
+		respondTusError(c, err)
+		return
+	}
+	defer unlock()
+
+	if err := tusStore.Terminate(id); err != nil {
+		respondTusError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handOffTusUpload enfileira o upload completo no mesmo pipeline de /upload.
+// Se a fila estiver cheia, o arquivo fica onde está e um novo PATCH vazio no
+// offset final tenta outra vez.
+func handOffTusUpload(c *gin.Context, info tus.Info) (tus.Info, error) {
+	credentials, err := requestCredentials(c)
+	if err != nil {
+		return info, err
+	}
+	req, err := uploadOptionsFromFields(info.Metadata)
+	if err != nil {
+		return info, err
+	}
+
+	dataPath := tusStore.DataPath(info.ID)
+	mimeType, err := media.DetectMimeType(dataPath)
+	if err != nil {
+		return info, err
+	}
+	if !media.IsVideoMime(mimeType) && !media.IsAudioMime(mimeType) {
+		// O arquivo nunca seria aceito; não vale a pena mantê-lo até expirar
+		if err := tusStore.Terminate(info.ID); err != nil {
+			logger.Error("remover upload tus: " + err.Error())
+		}
+		return info, errUnsupportedMediaType
+	}
+
+	req.credentials = credentials
+	req.mimeType = mimeType
+	req.source = requestSource(c, history.SourceTus)
+	req.publicBaseURL = publicBaseURL(c)
+	preferredName := cmp.Or(info.Metadata["filename"], info.Metadata["file_name"])
+
+	job, err := submitJob(c, credentials, func(ctx context.Context, report jobs.Reporter) (any, error) {
+		storeName, filePath, err := moveToStaging(dataPath, preferredName)
+		if err != nil {
+			return nil, err
+		}
+		req.storeName = storeName
+		req.filePath = filePath
+		response, err := buildUploadResponse(ctx, req, report)
+		if err != nil {
+			_ = os.Remove(filePath)
+			return nil, err
+		}
+		return response, nil
+	})
+	if err != nil {
+		return info, err
+	}
+
+	if err := tusStore.SetJobID(info.ID, job.ID); err != nil {
+		logger.Error("registrar job do upload tus: " + err.Error())
+	}
+	info.JobID = job.ID
+	return info, nil
+}
+
+func setTusHeaders(c *gin.Context, info tus.Info) {
+	c.Header("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	if !info.ExpiresAt.IsZero() {
+		c.Header("Upload-Expires", info.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	if info.JobID != "" {
+		c.Header("Upload-Job-Id", info.JobID)
+		c.Header("Upload-Job-Url", publicBaseURL(c)+"/jobs/"+info.JobID)
+	}
+}
+
+func respondTusError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, tus.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload não encontrado"})
+	case errors.Is(err, tus.ErrExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Upload expirado"})
+	case errors.Is(err, tus.ErrOffsetMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, tus.ErrLocked):
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	case errors.Is(err, tus.ErrExceedsLength):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gravar upload: " + err.Error()})
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/services"
+)
+
+// receivedFile é uma parte "file" de /upload já gravada na área de staging.
+type receivedFile struct {
+	fileName     string
+	explicitName bool // file_name enviado para esta parte
+	storeName    string
+	filePath     string
+	driveFileID  string // preenchido quando o arquivo foi enviado ao Drive durante a leitura
+	mimeType     string
+	hashes       *contentHashes
+	err          error // falha só deste arquivo; os demais seguem
+}
+
+// request completa base com os dados do arquivo.
+func (f receivedFile) request(base uploadRequest) uploadRequest {
+	req := base
+	req.filePath = f.filePath
+	req.storeName = f.storeName
+	req.driveFileName = f.fileName
+	req.mimeType = f.mimeType
+	req.driveFileID = f.driveFileID
+	req.hashes = f.hashes
+	return req
+}
+
+// receiveFilePart grava part na área de staging e, com streamToDrive, envia
+// ao Drive durante a leitura. Se falhar, o arquivo local já foi removido.
+func receiveFilePart(ctx context.Context, credentials services.CredentialProvider, part io.Reader, fileName, folderID string, streamToDrive bool) receivedFile {
+	file := receivedFile{fileName: fileName}
+
+	cleanName, err := sanitizeFilename(fileName)
+	if err != nil {
+		file.err = &requestError{http.StatusBadRequest, err.Error()}
+		return file
+	}
+	file.storeName = cleanName
+
+	// Criar arquivo local para backup/processamento
+	out, err := createStagingFile(cleanName)
+	if err != nil {
+		file.err = &requestError{http.StatusInternalServerError, "Falha ao criar arquivo local"}
+		return file
+	}
+	filePart := limitFileSize(part)
+	// Os hashes são calculados na mesma leitura que grava o arquivo em disco
+	hasher := newContentHasher()
+	local := io.MultiWriter(out, hasher)
+
+	if streamToDrive {
+		// TeeReader: Lê do part -> Escreve no out (disco) -> Retorna para o UploadFileStream
+		tee := io.TeeReader(filePart, local)
+		file.driveFileID, err = services.UploadFileStream(ctx, credentials, tee, folderID, fileName, services.DefaultUploadOptions())
+		if err != nil && !errors.Is(err, errFileTooLarge) {
+			err = &requestError{http.StatusInternalServerError, fmt.Sprintf("Erro no upload para o Drive: %v", err)}
+		}
+	} else {
+		// Sem envio imediato (async ou corpo assinado) apenas gravamos em disco
+		_, err = io.Copy(local, filePart)
+		if err != nil && !errors.Is(err, errFileTooLarge) {
+			err = &requestError{http.StatusInternalServerError, "Erro ao salvar arquivo local"}
+		}
+	}
+	// Fechar explicitamente para garantir o flush antes de usar o arquivo
+	out.Close()
+
+	if errors.Is(err, errFileTooLarge) {
+		err = fileTooLargeError()
+	}
+	if err == nil {
+		file.mimeType, err = media.DetectMimeType(out.Name())
+		if err != nil {
+			err = &requestError{http.StatusInternalServerError, "Erro ao detectar tipo de arquivo"}
+		}
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		file.err = err
+		return file
+	}
+
+	file.filePath = out.Name()
+	file.hashes = hasher.sum()
+	return file
+}
+
+func removeReceivedFiles(files []receivedFile) {
+	for _, file := range files {
+		if file.filePath != "" {
+			_ = os.Remove(file.filePath)
+		}
+	}
+}
+
+// processReceivedFiles roda o pipeline para cada arquivo de um /upload com
+// várias partes "file", um de cada vez, no formato de resultados do lote.
+func processReceivedFiles(ctx context.Context, base uploadRequest, files []receivedFile, report jobs.Reporter) gin.H {
+	results := make([]batchResult, len(files))
+	for i, file := range files {
+		var response gin.H
+		err := file.err
+		if err == nil {
+			response, err = buildUploadResponse(ctx, file.request(base), report)
+			if err != nil {
+				_ = os.Remove(file.filePath)
+			}
+		}
+		results[i] = newBatchResult(i, response, err)
+		results[i].FileName = file.fileName
+	}
+	return batchSummary(results)
+}
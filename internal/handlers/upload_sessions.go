@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"upload-drive-script/internal/auth"
+	"upload-drive-script/internal/config"
+	"upload-drive-script/internal/history"
+	"upload-drive-script/internal/jobs"
+	"upload-drive-script/internal/media"
+	"upload-drive-script/internal/services"
+	"upload-drive-script/pkg/logger"
+)
+
+// Drive descarta sessões resumable não concluídas após uma semana.
+const uploadSessionTTL = 7 * 24 * time.Hour
+
+var uploadSessionIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// uploadSession é uma sessão resumable do Drive entregue ao navegador, com
+// os campos do pedido para rodar o pipeline quando o envio terminar.
+type uploadSession struct {
+	ID        string            `json:"id"`
+	URI       string            `json:"uri"`
+	Fields    map[string]string `json:"fields"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// uploadSessionStore guarda as sessões em disco, uma por arquivo, para que
+// sobrevivam a um restart enquanto o navegador envia o arquivo.
+type uploadSessionStore struct {
+	dir string
+}
+
+func (s uploadSessionStore) path(id string) string { return filepath.Join(s.dir, id+".json") }
+
+func (s uploadSessionStore) load(id string) (*uploadSession, bool) {
+	if !uploadSessionIDPattern.MatchString(id) {
+		return nil, false
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return nil, false
+	}
+	var session uploadSession
+	if err := json.Unmarshal(data, &session); err != nil || session.URI == "" {
+		return nil, false
+	}
+	if time.Since(session.CreatedAt) > uploadSessionTTL {
+		s.remove(id)
+		return nil, false
+	}
+	return &session, true
+}
+
+func (s uploadSessionStore) save(session *uploadSession) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(session.ID), data, 0o600)
+}
+
+func (s uploadSessionStore) remove(id string) {
+	_ = os.Remove(s.path(id))
+}
+
+// Sessões sendo concluídas, para que dois callbacks não processem o mesmo arquivo.
+var (
+	completingMu       sync.Mutex
+	completingSessions = make(map[string]bool)
+)
+
+func lockUploadSession(id string) (func(), bool) {
+	completingMu.Lock()
+	defer completingMu.Unlock()
+	if completingSessions[id] {
+		return nil, false
+	}
+	completingSessions[id] = true
+	return func() {
+		completingMu.Lock()
+		delete(completingSessions, id)
+		completingMu.Unlock()
+	}, true
+}
+
+// CreateUploadSession abre, com o token do chamador, uma sessão resumable do
+// Drive para o navegador enviar o arquivo direto ao Google. O corpo JSON
+// traz file_name (obrigatório), folder_id, size, mime_type e as opções de
+// /upload, que são aplicadas em /upload-sessions/:id/complete.
+func CreateUploadSession(c *gin.Context) {
+	credentials, err := requestCredentials(c)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	fields, err := decodeSessionFields(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := auth.FinishBody(c.Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileName := strings.TrimSpace(fields["file_name"])
+	if fileName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_name é obrigatório"})
+		return
+	}
+
+	size := int64(-1)
+	if value := fields["size"]; value != "" {
+		size, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size deve ser um número de bytes positivo"})
+			return
+		}
+		if exceedsMaxFileSize(size, 0) {
+			respondUploadError(c, fileTooLargeError())
+			return
+		}
+	}
+
+	mimeType := fields["mime_type"]
+	if mimeType != "" && !media.IsVideoMime(mimeType) && !media.IsAudioMime(mimeType) {
+		respondUploadError(c, errUnsupportedMediaType)
+		return
+	}
+
+	// Opções inválidas são recusadas antes de o navegador enviar o arquivo
+	if _, err := uploadOptionsFromFields(fields); err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	// O Drive só aceita os PUTs do navegador se a sessão for criada com a mesma origem
+	origin := cmp.Or(fields["origin"], c.GetHeader("Origin"))
+	sessionURI, err := services.StartUploadSession(c.Request.Context(), credentials, fields["folder_id"], fileName, mimeType, size, origin)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Erro ao criar sessão no Drive: %v", err)})
+		return
+	}
+
+	id, err := newUploadSessionID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	session := &uploadSession{ID: id, URI: sessionURI, Fields: fields, CreatedAt: time.Now()}
+	if err := uploadSessions().save(session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao registrar sessão: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"session_id":   id,
+		"upload_url":   sessionURI,
+		"complete_url": publicBaseURL(c) + "/upload-sessions/" + id + "/complete",
+		"expires_at":   session.CreatedAt.Add(uploadSessionTTL),
+	})
+}
+
+// CompleteUploadSession confere no Drive que o envio do navegador terminou,
+// baixa o arquivo e roda o restante do pipeline de /upload (áudio, prévias,
+// cópia local) sem reenviá-lo. Com async=true tudo acontece em um job.
+func CompleteUploadSession(c *gin.Context) {
+	credentials, err := requestCredentials(c)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if err := auth.FinishBody(c.Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	store := uploadSessions()
+	session, ok := store.load(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sessão de upload não encontrada"})
+		return
+	}
+
+	unlock, ok := lockUploadSession(id)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Sessão de upload já está sendo concluída"})
+		return
+	}
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			unlock()
+		}
+	}()
+
+	fileID, committed, err := services.UploadSessionStatus(c.Request.Context(), credentials, session.URI)
+	if errors.Is(err, services.ErrSessionExpired) {
+		store.remove(id)
+		c.JSON(http.StatusGone, gin.H{"error": "Sessão de upload expirada no Drive"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Erro ao consultar sessão no Drive: %v", err)})
+		return
+	}
+	if fileID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "O envio para o Drive ainda não terminou", "bytes_received": committed})
+		return
+	}
+
+	req, err := uploadOptionsFromFields(session.Fields)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	req.credentials = credentials
+	req.folderID = session.Fields["folder_id"]
+	req.driveFileID = fileID
+	req.source = requestSource(c, history.SourceBrowser)
+	req.publicBaseURL = publicBaseURL(c)
+
+	if wantsAsync(c.Query("async")) {
+		job, err := submitJob(c, credentials, func(ctx context.Context, report jobs.Reporter) (any, error) {
+			defer unlock()
+			return completeDriveSession(ctx, store, session, req, report)
+		})
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		handedOff = true
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"job_id":     job.ID,
+			"status":     job.Status,
+			"status_url": req.publicBaseURL + "/jobs/" + job.ID,
+		})
+		return
+	}
+
+	response, err := completeDriveSession(c.Request.Context(), store, session, req, jobs.NopReporter)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// completeDriveSession baixa o arquivo que o navegador enviou ao Drive e o
+// passa ao pipeline. A sessão só é descartada quando não há o que repetir:
+// sucesso ou arquivo que nunca seria aceito.
+func completeDriveSession(ctx context.Context, store uploadSessionStore, session *uploadSession, req uploadRequest, report jobs.Reporter) (gin.H, error) {
+	response, err := processDriveFile(ctx, req, report)
+	if err == nil || errors.Is(err, errUnsupportedMediaType) {
+		store.remove(session.ID)
+	}
+	return response, err
+}
+
+func processDriveFile(ctx context.Context, req uploadRequest, report jobs.Reporter) (gin.H, error) {
+	info, err := services.GetFileInfo(ctx, req.credentials, req.driveFileID)
+	if err != nil {
+		return nil, &requestError{http.StatusBadGateway, fmt.Sprintf("Erro ao consultar arquivo no Drive: %v", err)}
+	}
+	if exceedsMaxFileSize(info.Size, 0) {
+		return nil, fileTooLargeError()
+	}
+	if req.driveFileName == "" {
+		req.driveFileName = info.Name
+	}
+
+	storeName, err := generateSafeFilename(info.Name)
+	if err != nil {
+		return nil, err
+	}
+	out, err := createStagingFile(storeName)
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível criar arquivo local: %w", err)
+	}
+	filePath := out.Name()
+
+	err = downloadDriveFile(ctx, req, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		req.mimeType, err = media.DetectMimeType(filePath)
+	}
+	if err != nil {
+		_ = os.Remove(filePath)
+		return nil, err
+	}
+
+	req.storeName = storeName
+	req.filePath = filePath
+	response, err := buildUploadResponse(ctx, req, report)
+	if err != nil {
+		_ = os.Remove(filePath)
+		return nil, err
+	}
+	return response, nil
+}
+
+func downloadDriveFile(ctx context.Context, req uploadRequest, out io.Writer) error {
+	body, err := services.OpenFile(ctx, req.credentials, req.driveFileID)
+	if err != nil {
+		return &requestError{http.StatusBadGateway, fmt.Sprintf("Erro ao baixar arquivo do Drive: %v", err)}
+	}
+	defer body.Close()
+
+	_, err = io.Copy(out, limitFileSize(body))
+	if errors.Is(err, errFileTooLarge) {
+		return fileTooLargeError()
+	}
+	if err != nil {
+		logger.Info("download do Drive falhou: " + err.Error())
+		return &requestError{http.StatusBadGateway, "Erro ao baixar arquivo do Drive"}
+	}
+	return nil
+}
+
+func decodeSessionFields(body io.Reader) (map[string]string, error) {
+	var raw map[string]formField
+	if err := json.NewDecoder(io.LimitReader(body, batchBodyLimit)).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("JSON inválido: %w", err)
+	}
+	fields := make(map[string]string, len(raw))
+	for key, value := range raw {
+		fields[key] = string(value)
+	}
+	return fields, nil
+}
+
+func uploadSessions() uploadSessionStore {
+	return uploadSessionStore{dir: config.UploadSessionDir()}
+}
+
+func newUploadSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("gerar ID da sessão: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
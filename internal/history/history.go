@@ -0,0 +1,360 @@
+// Package history keeps a persistent record of every upload processed by the
+// service in an embedded bbolt database. Records are indexed by start time,
+// user and SHA-256, so queries read only the candidates of the most selective
+// index instead of the whole history.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"upload-drive-script/pkg/logger"
+)
+
+// Sources of an upload.
+const (
+	SourceMultipart = "multipart"
+	SourceURL       = "url"
+	SourceTus       = "tus"
+	SourceBrowser   = "browser"
+)
+
+// Outcomes of an upload.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Record describes one upload that went through the pipeline.
+type Record struct {
+	ID        string `json:"id"`
+	Source    string `json:"source"`
+	SourceURL string `json:"source_url,omitempty"`
+	// User is the Google account of the Drive token, when tokens are
+	// verified; APIKeyID is the API key that made the request.
+	User     string `json:"user,omitempty"`
+	APIKeyID string `json:"api_key_id,omitempty"`
+	FileName string `json:"file_name,omitempty"`
+	FolderID string `json:"folder_id,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256,omitempty"`
+	MD5      string `json:"md5,omitempty"`
+	// VideoFileID and AudioFileID are Drive IDs; audio uploads only have
+	// AudioFileID.
+	VideoFileID string `json:"video_file_id,omitempty"`
+	AudioFileID string `json:"audio_file_id,omitempty"`
+	// StoredFiles are the names of the local copies in the storage backend.
+	StoredFiles []string  `json:"stored_files,omitempty"`
+	Status      string    `json:"status"`
+	Duplicate   bool      `json:"duplicate,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// Filter selects records in List. Empty fields match everything.
+type Filter struct {
+	Source   string
+	Status   string
+	User     string
+	APIKeyID string
+	FolderID string
+	// MimeType matches exactly, or as a prefix when it ends in "/" (e.g. "video/").
+	MimeType string
+	// FileName matches case-insensitively anywhere in the name.
+	FileName    string
+	SHA256      string
+	DriveFileID string
+	Since       time.Time
+	Until       time.Time
+
+	Offset int
+	Limit  int
+}
+
+func (f Filter) match(r Record) bool {
+	switch {
+	case f.Source != "" && r.Source != f.Source,
+		f.Status != "" && r.Status != f.Status,
+		f.User != "" && !strings.EqualFold(r.User, f.User),
+		f.APIKeyID != "" && r.APIKeyID != f.APIKeyID,
+		f.FolderID != "" && r.FolderID != f.FolderID,
+		f.SHA256 != "" && !strings.EqualFold(r.SHA256, f.SHA256),
+		f.DriveFileID != "" && r.VideoFileID != f.DriveFileID && r.AudioFileID != f.DriveFileID,
+		!f.Since.IsZero() && r.StartedAt.Before(f.Since),
+		!f.Until.IsZero() && !r.StartedAt.Before(f.Until):
+		return false
+	}
+	if f.MimeType != "" {
+		if prefix, ok := strings.CutSuffix(f.MimeType, "/"); ok {
+			if !strings.HasPrefix(r.MimeType, prefix+"/") {
+				return false
+			}
+		} else if r.MimeType != f.MimeType {
+			return false
+		}
+	}
+	if f.FileName != "" && !strings.Contains(strings.ToLower(r.FileName), strings.ToLower(f.FileName)) {
+		return false
+	}
+	return true
+}
+
+// Buckets do banco: os registros por ID e os índices, cujas chaves terminam
+// em <início do upload><ID> e apontam para o ID.
+var (
+	recordsBucket   = []byte("records")
+	byStartedBucket = []byte("by_started_at")
+	byUserBucket    = []byte("by_user")
+	bySHA256Bucket  = []byte("by_sha256")
+)
+
+// Store is the upload history. It is safe for concurrent use.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open loads the history database kept at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// O timeout evita travar a inicialização quando outro processo usa o banco
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("abrir histórico de uploads: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{recordsBucket, byStartedBucket, byUserBucket, bySHA256Bucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("abrir histórico de uploads: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Add stores record, assigning its ID, and returns the stored copy.
+func (s *Store) Add(record Record) (Record, error) {
+	id, err := newID()
+	if err != nil {
+		return Record{}, err
+	}
+	record.ID = id
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, record)
+	})
+	if err != nil {
+		return Record{}, fmt.Errorf("gravar histórico de uploads: %w", err)
+	}
+	return record, nil
+}
+
+// Import copies the records of a JSON Lines history written by earlier
+// versions, keeping their IDs. Records already present are skipped, so an
+// interrupted import can be repeated. It returns how many were added.
+func (s *Store) Import(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	skipped := 0
+	for scanner.Scan() {
+		var record Record
+		// Uma linha cortada por uma queda no meio da gravação é descartada
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.ID == "" {
+			skipped++
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("ler histórico de uploads: %w", err)
+	}
+	if skipped > 0 {
+		logger.Error(fmt.Sprintf("histórico de uploads: %d linha(s) inválida(s) ignorada(s) em %s", skipped, path))
+	}
+
+	added := 0
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for _, record := range records {
+			if tx.Bucket(recordsBucket).Get([]byte(record.ID)) != nil {
+				continue
+			}
+			if err := put(tx, record); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("importar histórico de uploads: %w", err)
+	}
+	return added, nil
+}
+
+// Get returns the record with the given ID.
+func (s *Store) Get(id string) (Record, bool, error) {
+	var (
+		record Record
+		found  bool
+	)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(recordsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &record)
+	})
+	if err != nil {
+		return Record{}, false, fmt.Errorf("ler histórico de uploads: %w", err)
+	}
+	return record, found, nil
+}
+
+// List returns the records matching f, newest first, paginated by f.Offset
+// and f.Limit, plus the total number of matches. Filters on SHA-256, user and
+// time range are answered from indexes; the others are checked on the
+// records those indexes select.
+func (s *Store) List(f Filter) ([]Record, int, error) {
+	page := make([]Record, 0, max(f.Limit, 0))
+	total := 0
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		index, prefix := byStartedBucket, []byte(nil)
+		switch {
+		case f.SHA256 != "":
+			index, prefix = bySHA256Bucket, indexPrefix(f.SHA256)
+		case f.User != "":
+			index, prefix = byUserBucket, indexPrefix(f.User)
+		}
+		records := tx.Bucket(recordsBucket)
+
+		// Percorre o índice de trás para frente a partir de until (exclusivo)
+		upper := append(bytes.Clone(prefix), bytes.Repeat([]byte{0xff}, 8)...)
+		if !f.Until.IsZero() {
+			upper = append(bytes.Clone(prefix), timeKey(f.Until)...)
+		}
+		cursor := tx.Bucket(index).Cursor()
+		k, v := cursor.Seek(upper)
+		if k == nil {
+			k, v = cursor.Last()
+		} else {
+			k, v = cursor.Prev()
+		}
+
+		var since []byte
+		if !f.Since.IsZero() {
+			since = timeKey(f.Since)
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Prev() {
+			if since != nil && bytes.Compare(k[len(prefix):len(prefix)+8], since) < 0 {
+				break
+			}
+
+			data := records.Get(v)
+			if data == nil {
+				continue
+			}
+			var record Record
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+			if !f.match(record) {
+				continue
+			}
+			if total >= f.Offset && (f.Limit <= 0 || len(page) < f.Limit) {
+				page = append(page, record)
+			}
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("consultar histórico de uploads: %w", err)
+	}
+	return page, total, nil
+}
+
+// Close releases the history database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// put grava o registro e as entradas dele nos índices.
+func put(tx *bolt.Tx, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	id := []byte(record.ID)
+	if err := tx.Bucket(recordsBucket).Put(id, data); err != nil {
+		return err
+	}
+
+	suffix := append(timeKey(record.StartedAt), id...)
+	if err := tx.Bucket(byStartedBucket).Put(suffix, id); err != nil {
+		return err
+	}
+	if record.User != "" {
+		if err := tx.Bucket(byUserBucket).Put(append(indexPrefix(record.User), suffix...), id); err != nil {
+			return err
+		}
+	}
+	if record.SHA256 != "" {
+		if err := tx.Bucket(bySHA256Bucket).Put(append(indexPrefix(record.SHA256), suffix...), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexPrefix normaliza o valor indexado, pois os filtros não diferenciam
+// maiúsculas, e o separa do horário que vem em seguida.
+func indexPrefix(value string) []byte {
+	return append([]byte(strings.ToLower(value)), 0)
+}
+
+// timeKey codifica t de forma que a ordem dos bytes siga a ordem cronológica.
+// Horários anteriores a 1970 ficam todos em zero.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	if nanos := t.UnixNano(); nanos > 0 {
+		binary.BigEndian.PutUint64(key, uint64(nanos))
+	}
+	return key
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,148 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func fileNames(records []Record) []string {
+	names := make([]string, 0, len(records))
+	for _, r := range records {
+		names = append(names, r.FileName)
+	}
+	return names
+}
+
+func TestList(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "history.db"))
+	base := time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	for i, r := range []Record{
+		{FileName: "a.mp4", User: "pessoa@example.com", SHA256: "AAAA", MimeType: "video/mp4", Status: StatusSucceeded},
+		{FileName: "b.mp3", User: "outra@example.com", SHA256: "bbbb", MimeType: "audio/mpeg", Status: StatusSucceeded},
+		{FileName: "c.mp4", User: "Pessoa@Example.com", SHA256: "aaaa", MimeType: "video/mp4", Status: StatusFailed},
+		{FileName: "d.mov", SHA256: "cccc", MimeType: "video/quicktime", Status: StatusSucceeded},
+		{FileName: "e.mp4", User: "pessoa@example.com", MimeType: "video/mp4", Status: StatusSucceeded},
+	} {
+		r.StartedAt = base.Add(time.Duration(i) * time.Hour)
+		if _, err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+		total  int
+	}{
+		{"tudo, do mais recente ao mais antigo", Filter{}, []string{"e.mp4", "d.mov", "c.mp4", "b.mp3", "a.mp4"}, 5},
+		{"por usuário, sem diferenciar maiúsculas", Filter{User: "PESSOA@example.com"}, []string{"e.mp4", "c.mp4", "a.mp4"}, 3},
+		{"por sha256", Filter{SHA256: "aaaa"}, []string{"c.mp4", "a.mp4"}, 2},
+		{"índice combinado com outro filtro", Filter{SHA256: "aaaa", Status: StatusSucceeded}, []string{"a.mp4"}, 1},
+		{"intervalo: since inclusivo, until exclusivo", Filter{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)}, []string{"c.mp4", "b.mp3"}, 2},
+		{"usuário e intervalo", Filter{User: "pessoa@example.com", Since: base.Add(time.Hour)}, []string{"e.mp4", "c.mp4"}, 2},
+		{"prefixo de mime", Filter{MimeType: "video/"}, []string{"e.mp4", "d.mov", "c.mp4", "a.mp4"}, 4},
+		{"paginação", Filter{Offset: 1, Limit: 2}, []string{"d.mov", "c.mp4"}, 5},
+		{"sem resultados", Filter{User: "ninguem@example.com"}, []string{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, total, err := s.List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fileNames(records); !slices.Equal(got, tt.want) {
+				t.Errorf("List = %v, esperado %v", got, tt.want)
+			}
+			if total != tt.total {
+				t.Errorf("total = %d, esperado %d", total, tt.total)
+			}
+		})
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := s.Add(Record{FileName: "a.mp4", StoredFiles: []string{"a.mp4"}, StartedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, path)
+	got, ok, err := s.Get(added.ID)
+	if err != nil || !ok {
+		t.Fatalf("Get depois de reabrir: ok=%v, err=%v", ok, err)
+	}
+	if got.FileName != "a.mp4" || !slices.Equal(got.StoredFiles, []string{"a.mp4"}) {
+		t.Errorf("registro lido = %+v", got)
+	}
+	if _, ok, _ := s.Get("inexistente"); ok {
+		t.Error("Get encontrou um ID inexistente")
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "history.jsonl")
+
+	var lines []byte
+	for i, name := range []string{"a.mp4", "b.mp4"} {
+		data, err := json.Marshal(Record{
+			ID:        name + "-id",
+			FileName:  name,
+			User:      "pessoa@example.com",
+			StartedAt: time.Date(2025, 1, 31, 12, i, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(append(lines, data...), '\n')
+	}
+	// Linha cortada por uma queda durante a gravação
+	lines = append(lines, `{"id":"c`...)
+	if err := os.WriteFile(legacy, lines, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestStore(t, filepath.Join(dir, "history.db"))
+	for _, want := range []int{2, 0} {
+		added, err := s.Import(legacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != want {
+			t.Fatalf("Import adicionou %d registros, esperado %d", added, want)
+		}
+	}
+
+	records, total, err := s.List(Filter{User: "pessoa@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || records[0].ID != "b.mp4-id" {
+		t.Fatalf("registros importados = %+v", records)
+	}
+}
@@ -0,0 +1,278 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"upload-drive-script/pkg/logger"
+)
+
+// Stage identifies the step of the upload pipeline a job is currently in.
+type Stage string
+
+const (
+	StageReceived     Stage = "received"
+	StageDriveUpload  Stage = "drive_upload"
+	StageAudioExtract Stage = "audio_extract"
+	StageAudioUpload  Stage = "audio_upload"
+	StagePreview      Stage = "preview"
+	StageTranscode    Stage = "transcode"
+	StageHLSPackage   Stage = "hls_package"
+	StageDone         Stage = "done"
+	StageFailed       Stage = "failed"
+)
+
+var ErrQueueFull = errors.New("fila de processamento cheia")
+
+// StageEntry records when a job entered a given stage.
+type StageEntry struct {
+	Stage Stage     `json:"stage"`
+	At    time.Time `json:"at"`
+}
+
+// Progress describes how many bytes of the current transfer were sent.
+// Total is -1 while the final size is unknown.
+type Progress struct {
+	Stage      Stage `json:"stage"`
+	BytesSent  int64 `json:"bytes_sent"`
+	BytesTotal int64 `json:"bytes_total"`
+}
+
+// Job is a snapshot of an asynchronous pipeline execution.
+type Job struct {
+	ID        string       `json:"id"`
+	Owner     string       `json:"-"`
+	Status    Stage        `json:"status"`
+	Stages    []StageEntry `json:"stages"`
+	Progress  *Progress    `json:"progress,omitempty"`
+	Result    any          `json:"result,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Reporter receives stage transitions and transfer progress from a job function.
+type Reporter interface {
+	Stage(Stage)
+	Progress(sent, total int64)
+}
+
+// NopReporter discards every report; used when the pipeline runs inline.
+var NopReporter Reporter = nopReporter{}
+
+type nopReporter struct{}
+
+func (nopReporter) Stage(Stage)           {}
+func (nopReporter) Progress(int64, int64) {}
+
+type jobReporter struct {
+	m  *Manager
+	id string
+}
+
+func (r jobReporter) Stage(stage Stage)          { r.m.setStage(r.id, stage) }
+func (r jobReporter) Progress(sent, total int64) { r.m.setProgress(r.id, sent, total) }
+
+// Func is the unit of work executed by the worker pool.
+type Func func(ctx context.Context, report Reporter) (any, error)
+
+type task struct {
+	id string
+	fn Func
+}
+
+// Manager runs submitted jobs on a bounded pool of workers fed by a queue.
+type Manager struct {
+	mu        sync.RWMutex
+	jobs      map[string]*Job
+	queue     chan task
+	retention time.Duration
+	ctx       context.Context
+}
+
+// NewManager starts workers goroutines consuming a queue with room for
+// queueSize pending jobs. Finished jobs are forgotten after retention.
+func NewManager(workers, queueSize int, retention time.Duration) *Manager {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	m := &Manager{
+		jobs:      make(map[string]*Job),
+		queue:     make(chan task, queueSize),
+		retention: retention,
+		ctx:       context.Background(),
+	}
+
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	return m
+}
+
+// Submit enqueues fn on behalf of owner and returns the initial job snapshot.
+// It fails with ErrQueueFull when the queue has no room left.
+func (m *Manager) Submit(owner string, fn Func) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:        id,
+		Owner:     owner,
+		Status:    StageReceived,
+		Stages:    []StageEntry{{Stage: StageReceived, At: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	m.mu.Lock()
+	m.pruneLocked(now)
+	m.jobs[id] = job
+	snapshot := job.clone()
+	m.mu.Unlock()
+
+	select {
+	case m.queue <- task{id: id, fn: fn}:
+		return snapshot, nil
+	default:
+		m.mu.Lock()
+		delete(m.jobs, id)
+		m.mu.Unlock()
+		return Job{}, ErrQueueFull
+	}
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.clone(), true
+}
+
+// List returns snapshots of every known job, newest first.
+func (m *Manager) List() []Job {
+	m.mu.RLock()
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, job.clone())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+func (m *Manager) worker() {
+	for t := range m.queue {
+		m.run(t)
+	}
+}
+
+func (m *Manager) run(t task) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.finish(t.id, nil, fmt.Errorf("panic no job: %v", r))
+		}
+	}()
+
+	result, err := t.fn(m.ctx, jobReporter{m: m, id: t.id})
+	m.finish(t.id, result, err)
+}
+
+func (m *Manager) setStage(id string, stage Stage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	job.Status = stage
+	job.Stages = append(job.Stages, StageEntry{Stage: stage, At: now})
+	job.UpdatedAt = now
+}
+
+func (m *Manager) setProgress(id string, sent, total int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	job.Progress = &Progress{Stage: job.Status, BytesSent: sent, BytesTotal: total}
+	job.UpdatedAt = time.Now()
+}
+
+func (m *Manager) finish(id string, result any, err error) {
+	if err != nil {
+		logger.Error(fmt.Sprintf("job %s falhou: %v", id, err))
+		m.mu.Lock()
+		if job, ok := m.jobs[id]; ok {
+			job.Error = err.Error()
+		}
+		m.mu.Unlock()
+		m.setStage(id, StageFailed)
+		return
+	}
+
+	m.mu.Lock()
+	if job, ok := m.jobs[id]; ok {
+		job.Result = result
+	}
+	m.mu.Unlock()
+	m.setStage(id, StageDone)
+}
+
+func (m *Manager) pruneLocked(now time.Time) {
+	if m.retention <= 0 {
+		return
+	}
+	for id, job := range m.jobs {
+		if job.finished() && now.Sub(job.UpdatedAt) > m.retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func (j *Job) finished() bool {
+	return j.Status == StageDone || j.Status == StageFailed
+}
+
+func (j *Job) clone() Job {
+	c := *j
+	c.Stages = append([]StageEntry(nil), j.Stages...)
+	if j.Progress != nil {
+		progress := *j.Progress
+		c.Progress = &progress
+	}
+	return c
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("gerar ID do job: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,81 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// HLSPlaylistName is the master playlist written by PackageHLS.
+const HLSPlaylistName = "index.m3u8"
+
+// HLSOptions controls the HLS segmentation.
+type HLSOptions struct {
+	SegmentDuration time.Duration
+	// AudioOnly drops the video streams, e.g. for extracted audio tracks.
+	AudioOnly bool
+	// Preset is the libx264 preset used when the video must be re-encoded.
+	Preset string
+}
+
+// PackageHLS segments srcPath into a VOD HLS playlist (index.m3u8) plus
+// MPEG-TS segments inside outDir. H.264/AAC sources are copied without
+// re-encoding; anything else is converted so every browser player can use it.
+func PackageHLS(ctx context.Context, srcPath, outDir string, meta *Metadata, opts HLSOptions) error {
+	if opts.SegmentDuration <= 0 {
+		opts.SegmentDuration = 6 * time.Second
+	}
+	if opts.Preset == "" {
+		opts.Preset = "veryfast"
+	}
+
+	args := []string{"-y", "-i", srcPath}
+	if opts.AudioOnly {
+		args = append(args, "-vn", "-map", "0:a:0")
+	} else {
+		args = append(args, "-map", "0:v:0", "-map", "0:a:0?")
+	}
+	args = append(args, hlsCodecArgs(meta, opts)...)
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.FormatFloat(opts.SegmentDuration.Seconds(), 'f', -1, 64),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(outDir, "segment_%05d.ts"),
+		filepath.Join(outDir, HLSPlaylistName),
+	)
+
+	if err := runFFmpeg(ctx, args); err != nil {
+		return fmt.Errorf("falha ao gerar HLS (ffmpeg): %w", err)
+	}
+	return nil
+}
+
+func hlsCodecArgs(meta *Metadata, opts HLSOptions) []string {
+	copyVideo := !opts.AudioOnly && meta != nil && meta.Video != nil && meta.Video.Codec == "h264"
+	copyAudio := meta != nil
+	if meta != nil {
+		for _, s := range meta.Streams {
+			if s.Type == "audio" {
+				copyAudio = s.Codec == "aac"
+				break
+			}
+		}
+	}
+
+	var args []string
+	if !opts.AudioOnly {
+		if copyVideo {
+			args = append(args, "-c:v", "copy")
+		} else {
+			args = append(args, "-c:v", "libx264", "-preset", opts.Preset, "-pix_fmt", "yuv420p")
+		}
+	}
+	if copyAudio {
+		args = append(args, "-c:a", "copy")
+	} else {
+		args = append(args, "-c:a", "aac", "-b:a", "128k")
+	}
+	return args
+}
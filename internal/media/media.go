@@ -2,18 +2,18 @@ package media
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
-const audioExtension = ".mp3"
-
 // DetectMimeType infers the MIME type of a file by reading its header bytes.
 func DetectMimeType(path string) (string, error) {
 	f, err := os.Open(path)
@@ -38,29 +38,72 @@ func IsAudioMime(mime string) bool {
 	return strings.HasPrefix(mime, "audio/")
 }
 
-// ExtractAudio uses ffmpeg to extract an audio track from a video file.
+// ExtractAudio uses ffmpeg to extract an audio track from a video file,
+// encoding it according to profile. streamIndex selects the absolute stream
+// index to extract; a negative value lets ffmpeg pick the default stream.
 // Returns the path to the generated audio file (caller must remove it).
-func ExtractAudio(srcPath string) (string, error) {
-	dst, err := os.CreateTemp("", "audio-*"+audioExtension)
+func ExtractAudio(ctx context.Context, srcPath string, profile AudioProfile, streamIndex int) (string, error) {
+	dst, err := os.CreateTemp("", "audio-*"+profile.extension())
 	if err != nil {
 		return "", fmt.Errorf("criar arquivo temporário para áudio: %w", err)
 	}
 	dstPath := dst.Name()
 	dst.Close()
 
+	args := []string{"-y", "-i", srcPath, "-vn"}
+	if streamIndex >= 0 {
+		args = append(args, "-map", "0:"+strconv.Itoa(streamIndex))
+	}
+	args = append(args, profile.ffmpegArgs()...)
+
+	if err := runFFmpeg(ctx, append(args, dstPath)); err != nil {
+		_ = os.Remove(dstPath)
+		return "", fmt.Errorf("falha ao extrair áudio (ffmpeg): %w", err)
+	}
+
+	return dstPath, nil
+}
+
+// runFFmpeg runs ffmpeg with args. The process is killed when ctx is done,
+// so callers bound it with the request or job context plus a timeout.
+func runFFmpeg(ctx context.Context, args []string) error {
 	var stderr bytes.Buffer
-	cmd := exec.Command("ffmpeg", "-y", "-i", srcPath, "-vn", "-acodec", "libmp3lame", dstPath)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 	cmd.Stderr = &stderr
+	cmd.WaitDelay = 5 * time.Second
 
 	if err := cmd.Run(); err != nil {
-		_ = os.Remove(dstPath)
-		return "", fmt.Errorf("falha ao extrair áudio (ffmpeg): %w - %s", err, stderr.String())
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("processo interrompido: %w", ctxErr)
+		}
+		return fmt.Errorf("%w - %s", err, stderr.String())
 	}
+	return nil
+}
 
-	return dstPath, nil
+// BuildAudioFileName derives the audio file name from the video name, using
+// the container extension of profile.
+func BuildAudioFileName(originalPreferredName, fallbackPath string, profile AudioProfile) string {
+	return audioBaseName(originalPreferredName, fallbackPath) + "-audio" + profile.extension()
+}
+
+// BuildAudioTrackFileName names the file of one specific audio stream, e.g.
+// "video-audio-2-por.mp3", so several tracks of the same video don't collide.
+func BuildAudioTrackFileName(originalPreferredName, fallbackPath string, profile AudioProfile, stream AudioStream) string {
+	suffix := "-audio-" + strconv.Itoa(stream.Index)
+	language := strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, stream.Language)
+	if language != "" {
+		suffix += "-" + language
+	}
+	return audioBaseName(originalPreferredName, fallbackPath) + suffix + profile.extension()
 }
 
-func BuildAudioFileName(originalPreferredName, fallbackPath string) string {
+func audioBaseName(originalPreferredName, fallbackPath string) string {
 	baseName := originalPreferredName
 	if baseName == "" {
 		baseName = filepath.Base(fallbackPath)
@@ -70,5 +113,5 @@ func BuildAudioFileName(originalPreferredName, fallbackPath string) string {
 		baseName = fmt.Sprintf("audio-%d", time.Now().Unix())
 	}
 
-	return baseName + "-audio" + audioExtension
+	return baseName
 }
@@ -0,0 +1,193 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStoryboardTiles bounds the sprite size for long videos; the interval is
+// stretched so the whole duration still fits.
+const maxStoryboardTiles = 100
+
+// StoryboardOptions controls how the storyboard sprite is laid out.
+type StoryboardOptions struct {
+	Interval  time.Duration
+	Columns   int
+	TileWidth int
+}
+
+// Storyboard describes a generated sprite sheet. Frames are laid out left to
+// right, top to bottom, one every Interval.
+type Storyboard struct {
+	Path       string // caller must remove it
+	Interval   time.Duration
+	Columns    int
+	Rows       int
+	Count      int
+	TileWidth  int
+	TileHeight int
+	Duration   time.Duration
+}
+
+// GenerateThumbnail extracts a single JPEG frame at the given timestamp.
+// Timestamps past the end of the video fall back to its middle.
+// Returns the path to the generated image (caller must remove it).
+func GenerateThumbnail(ctx context.Context, srcPath string, at time.Duration, meta *Metadata) (string, error) {
+	if meta != nil && meta.DurationSeconds > 0 && at.Seconds() >= meta.DurationSeconds {
+		at = time.Duration(meta.DurationSeconds / 2 * float64(time.Second))
+	}
+	if at < 0 {
+		at = 0
+	}
+
+	dstPath, err := createTempPath("thumbnail-*.jpg")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{
+		"-y",
+		"-ss", formatSeconds(at),
+		"-i", srcPath,
+		"-frames:v", "1",
+		"-q:v", "2",
+		dstPath,
+	}
+	if err := runFFmpeg(ctx, args); err != nil {
+		_ = os.Remove(dstPath)
+		return "", fmt.Errorf("falha ao gerar thumbnail (ffmpeg): %w", err)
+	}
+
+	return dstPath, nil
+}
+
+// GenerateStoryboard renders a sprite sheet with one frame every opts.Interval.
+// It needs the probed duration and video dimensions to compute the grid.
+func GenerateStoryboard(ctx context.Context, srcPath string, meta *Metadata, opts StoryboardOptions) (*Storyboard, error) {
+	if meta == nil || meta.Video == nil || meta.DurationSeconds <= 0 {
+		return nil, errors.New("storyboard exige duração e dimensões do vídeo")
+	}
+	if meta.Video.Width <= 0 || meta.Video.Height <= 0 {
+		return nil, errors.New("storyboard exige duração e dimensões do vídeo")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Columns <= 0 {
+		opts.Columns = 10
+	}
+	if opts.TileWidth <= 0 {
+		opts.TileWidth = 160
+	}
+
+	duration := time.Duration(meta.DurationSeconds * float64(time.Second))
+	count := int(math.Ceil(duration.Seconds() / opts.Interval.Seconds()))
+	if count > maxStoryboardTiles {
+		count = maxStoryboardTiles
+		opts.Interval = time.Duration(float64(duration) / maxStoryboardTiles)
+	}
+	if count < 1 {
+		count = 1
+	}
+
+	columns := opts.Columns
+	if count < columns {
+		columns = count
+	}
+	rows := (count + columns - 1) / columns
+
+	tileWidth := evenDimension(opts.TileWidth)
+	tileHeight := evenDimension(int(math.Round(float64(tileWidth) * float64(meta.Video.Height) / float64(meta.Video.Width))))
+
+	dstPath, err := createTempPath("storyboard-*.jpg")
+	if err != nil {
+		return nil, err
+	}
+
+	filter := fmt.Sprintf("fps=1/%s,scale=%d:%d,tile=%dx%d",
+		formatSeconds(opts.Interval), tileWidth, tileHeight, columns, rows)
+	args := []string{
+		"-y",
+		"-i", srcPath,
+		"-an",
+		"-vf", filter,
+		"-frames:v", "1",
+		"-q:v", "5",
+		dstPath,
+	}
+	if err := runFFmpeg(ctx, args); err != nil {
+		_ = os.Remove(dstPath)
+		return nil, fmt.Errorf("falha ao gerar storyboard (ffmpeg): %w", err)
+	}
+
+	return &Storyboard{
+		Path:       dstPath,
+		Interval:   opts.Interval,
+		Columns:    columns,
+		Rows:       rows,
+		Count:      count,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+		Duration:   duration,
+	}, nil
+}
+
+// WebVTT builds the storyboard index: one cue per frame pointing at its
+// region of the sprite through a media fragment (#xywh=x,y,w,h).
+func (s *Storyboard) WebVTT(spriteURL string) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+
+	for i := 0; i < s.Count; i++ {
+		start := time.Duration(i) * s.Interval
+		end := start + s.Interval
+		if end > s.Duration || i == s.Count-1 {
+			end = s.Duration
+		}
+		x := (i % s.Columns) * s.TileWidth
+		y := (i / s.Columns) * s.TileHeight
+
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			formatVTTTimestamp(start), formatVTTTimestamp(end), spriteURL, x, y, s.TileWidth, s.TileHeight)
+	}
+
+	return b.String()
+}
+
+// BuildDerivedFileName names files derived from the video, e.g.
+// "video-thumbnail.jpg" for suffix "-thumbnail" and extension ".jpg".
+func BuildDerivedFileName(originalPreferredName, fallbackPath, suffix, extension string) string {
+	return audioBaseName(originalPreferredName, fallbackPath) + suffix + extension
+}
+
+func createTempPath(pattern string) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("criar arquivo temporário: %w", err)
+	}
+	path := f.Name()
+	f.Close()
+	return path, nil
+}
+
+func evenDimension(value int) int {
+	if value < 2 {
+		return 2
+	}
+	return value &^ 1
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+func formatVTTTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,194 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Metadata is the typed view of ffprobe's format and stream information.
+type Metadata struct {
+	FormatName      string       `json:"format_name"`
+	FormatLongName  string       `json:"format_long_name,omitempty"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	SizeBytes       int64        `json:"size_bytes"`
+	BitRate         int64        `json:"bit_rate"`
+	Video           *StreamInfo  `json:"video,omitempty"` // first video stream, if any
+	Streams         []StreamInfo `json:"streams"`
+}
+
+// StreamInfo describes one stream of a media container.
+type StreamInfo struct {
+	Index           int     `json:"index"`
+	Type            string  `json:"type"` // video, audio, subtitle, data...
+	Codec           string  `json:"codec"`
+	Profile         string  `json:"profile,omitempty"`
+	Width           int     `json:"width,omitempty"`
+	Height          int     `json:"height,omitempty"`
+	FrameRate       float64 `json:"frame_rate,omitempty"`
+	PixelFormat     string  `json:"pixel_format,omitempty"`
+	SampleRate      int     `json:"sample_rate,omitempty"`
+	Channels        int     `json:"channels,omitempty"`
+	ChannelLayout   string  `json:"channel_layout,omitempty"`
+	BitRate         int64   `json:"bit_rate,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	Language        string  `json:"language,omitempty"`
+	Title           string  `json:"title,omitempty"`
+	Default         bool    `json:"default"`
+}
+
+// AudioStream describes an audio stream found in a media container.
+type AudioStream struct {
+	Index    int    `json:"index"` // absolute stream index, usable with ffmpeg -map 0:<index>
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Channels int    `json:"channels,omitempty"`
+	Default  bool   `json:"default"`
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		FormatName     string `json:"format_name"`
+		FormatLongName string `json:"format_long_name"`
+		Duration       string `json:"duration"`
+		Size           string `json:"size"`
+		BitRate        string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		Index         int               `json:"index"`
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		Profile       string            `json:"profile"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		PixFmt        string            `json:"pix_fmt"`
+		SampleRate    string            `json:"sample_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		BitRate       string            `json:"bit_rate"`
+		Duration      string            `json:"duration"`
+		Tags          map[string]string `json:"tags"`
+		Disposition   map[string]int    `json:"disposition"`
+	} `json:"streams"`
+}
+
+// Probe runs ffprobe on path and returns its container and stream metadata.
+func Probe(ctx context.Context, path string) (*Metadata, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_format",
+		"-show_streams",
+		"-of", "json",
+		path,
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("falha ao inspecionar arquivo (ffprobe): processo interrompido: %w", ctxErr)
+		}
+		return nil, fmt.Errorf("falha ao inspecionar arquivo (ffprobe): %w - %s", err, stderr.String())
+	}
+
+	var out ffprobeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("decodificar saída do ffprobe: %w", err)
+	}
+
+	meta := &Metadata{
+		FormatName:      out.Format.FormatName,
+		FormatLongName:  out.Format.FormatLongName,
+		DurationSeconds: parseFloat(out.Format.Duration),
+		SizeBytes:       parseInt(out.Format.Size),
+		BitRate:         parseInt(out.Format.BitRate),
+		Streams:         make([]StreamInfo, 0, len(out.Streams)),
+	}
+
+	for _, s := range out.Streams {
+		meta.Streams = append(meta.Streams, StreamInfo{
+			Index:           s.Index,
+			Type:            s.CodecType,
+			Codec:           s.CodecName,
+			Profile:         s.Profile,
+			Width:           s.Width,
+			Height:          s.Height,
+			FrameRate:       parseRational(s.AvgFrameRate),
+			PixelFormat:     s.PixFmt,
+			SampleRate:      int(parseInt(s.SampleRate)),
+			Channels:        s.Channels,
+			ChannelLayout:   s.ChannelLayout,
+			BitRate:         parseInt(s.BitRate),
+			DurationSeconds: parseFloat(s.Duration),
+			Language:        s.Tags["language"],
+			Title:           s.Tags["title"],
+			Default:         s.Disposition["default"] == 1,
+		})
+	}
+
+	for i := range meta.Streams {
+		// Capas embutidas (attached_pic) aparecem como vídeo mas não são o vídeo principal
+		if meta.Streams[i].Type == "video" && out.Streams[i].Disposition["attached_pic"] != 1 {
+			video := meta.Streams[i]
+			meta.Video = &video
+			break
+		}
+	}
+
+	return meta, nil
+}
+
+// AudioStreams returns the audio streams of the probed file.
+func (m *Metadata) AudioStreams() []AudioStream {
+	streams := []AudioStream{}
+	for _, s := range m.Streams {
+		if s.Type != "audio" {
+			continue
+		}
+		streams = append(streams, AudioStream{
+			Index:    s.Index,
+			Codec:    s.Codec,
+			Language: s.Language,
+			Title:    s.Title,
+			Channels: s.Channels,
+			Default:  s.Default,
+		})
+	}
+	return streams
+}
+
+func parseFloat(value string) float64 {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return parsed
+}
+
+func parseInt(value string) int64 {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return parsed
+}
+
+// parseRational converts ffprobe fractions such as "30000/1001".
+func parseRational(value string) float64 {
+	num, den, ok := strings.Cut(value, "/")
+	if !ok {
+		return parseFloat(value)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return parseFloat(num) / d
+}
@@ -0,0 +1,96 @@
+package media
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AudioProfile describes how ffmpeg encodes an extracted audio track.
+type AudioProfile struct {
+	Name       string `json:"name"`
+	Codec      string `json:"codec"`     // ffmpeg encoder, e.g. libmp3lame
+	Extension  string `json:"extension"` // container extension including the dot
+	Bitrate    string `json:"bitrate,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+	// Normalize applies EBU R128 loudness normalization (ffmpeg loudnorm).
+	Normalize bool `json:"normalize,omitempty"`
+	// ExtraArgs are appended right before the output path (container flags).
+	ExtraArgs []string `json:"-"`
+}
+
+// DefaultAudioProfileName is the profile used when AUDIO_DEFAULT_PROFILE is not set.
+const DefaultAudioProfileName = "mp3"
+
+var audioProfiles = map[string]AudioProfile{
+	// Comportamento histórico: mp3 com bitrate padrão do encoder
+	"mp3": {Name: "mp3", Codec: "libmp3lame", Extension: ".mp3"},
+	"mp3-192k": {
+		Name: "mp3-192k", Codec: "libmp3lame", Extension: ".mp3",
+		Bitrate: "192k", SampleRate: 44100, Channels: 2,
+	},
+	"podcast-mp3": {
+		Name: "podcast-mp3", Codec: "libmp3lame", Extension: ".mp3",
+		Bitrate: "192k", SampleRate: 44100, Channels: 2, Normalize: true,
+	},
+	"aac-192k": {
+		Name: "aac-192k", Codec: "aac", Extension: ".m4a",
+		Bitrate: "192k", SampleRate: 48000, Channels: 2,
+		ExtraArgs: []string{"-movflags", "+faststart"},
+	},
+	"podcast-aac": {
+		Name: "podcast-aac", Codec: "aac", Extension: ".m4a",
+		Bitrate: "192k", SampleRate: 48000, Channels: 2, Normalize: true,
+		ExtraArgs: []string{"-movflags", "+faststart"},
+	},
+	"wav-16k-mono": {
+		Name: "wav-16k-mono", Codec: "pcm_s16le", Extension: ".wav",
+		SampleRate: 16000, Channels: 1,
+	},
+	"opus-16k-mono": {
+		Name: "opus-16k-mono", Codec: "libopus", Extension: ".opus",
+		Bitrate: "24k", SampleRate: 16000, Channels: 1,
+	},
+}
+
+// LookupAudioProfile returns the profile registered under name (case-insensitive).
+func LookupAudioProfile(name string) (AudioProfile, bool) {
+	profile, ok := audioProfiles[strings.ToLower(strings.TrimSpace(name))]
+	return profile, ok
+}
+
+// AudioProfileNames lists the available profiles in alphabetical order.
+func AudioProfileNames() []string {
+	names := make([]string, 0, len(audioProfiles))
+	for name := range audioProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ffmpegArgs returns the encoder arguments for the profile.
+func (p AudioProfile) ffmpegArgs() []string {
+	args := []string{"-acodec", p.Codec}
+	if p.Bitrate != "" {
+		args = append(args, "-b:a", p.Bitrate)
+	}
+	if p.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(p.SampleRate))
+	}
+	if p.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(p.Channels))
+	}
+	if p.Normalize {
+		args = append(args, "-af", "loudnorm=I=-16:TP=-1.5:LRA=11")
+	}
+	return append(args, p.ExtraArgs...)
+}
+
+func (p AudioProfile) extension() string {
+	if p.Extension == "" {
+		return ".mp3"
+	}
+	return p.Extension
+}
@@ -0,0 +1,63 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// TranscodeOptions controls the H.264/AAC encoding of a web rendition.
+type TranscodeOptions struct {
+	// MaxHeight scales the video down (keeping the aspect ratio) when it is
+	// taller; zero keeps the original resolution.
+	MaxHeight    int
+	Preset       string // libx264 preset, e.g. veryfast
+	CRF          int
+	AudioBitrate string
+}
+
+// TranscodeMP4 encodes srcPath into an MP4 that browsers can play: H.264
+// (yuv420p) video, AAC audio and the moov atom at the start of the file.
+// Returns the path to the generated file (caller must remove it).
+func TranscodeMP4(ctx context.Context, srcPath string, opts TranscodeOptions) (string, error) {
+	if opts.Preset == "" {
+		opts.Preset = "veryfast"
+	}
+	if opts.CRF <= 0 {
+		opts.CRF = 23
+	}
+	if opts.AudioBitrate == "" {
+		opts.AudioBitrate = "128k"
+	}
+
+	dstPath, err := createTempPath("rendition-*.mp4")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{
+		"-y",
+		"-i", srcPath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-c:v", "libx264",
+		"-preset", opts.Preset,
+		"-crf", strconv.Itoa(opts.CRF),
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", opts.AudioBitrate,
+	}
+	if opts.MaxHeight > 0 {
+		// -2 mantém a proporção com largura par, exigida pelo H.264
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", opts.MaxHeight))
+	}
+	args = append(args, "-movflags", "+faststart", dstPath)
+
+	if err := runFFmpeg(ctx, args); err != nil {
+		_ = os.Remove(dstPath)
+		return "", fmt.Errorf("falha ao converter vídeo (ffmpeg): %w", err)
+	}
+
+	return dstPath, nil
+}
@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Extractor resolves video-site pages (YouTube, Vimeo...) by running an
+// external extractor compatible with yt-dlp's --dump-json output. Only the
+// listed hosts are handed to the command.
+type Extractor struct {
+	// Command and Args are run as: Command Args... -f Format --dump-json --no-playlist -- URL
+	Command string
+	Args    []string
+	Format  string
+	// Hosts are exact names or subdomain wildcards ("*.youtube.com").
+	Hosts   []string
+	Timeout time.Duration
+}
+
+// extractorOutput são os campos usados do JSON do yt-dlp.
+type extractorOutput struct {
+	URL         string            `json:"url"`
+	Title       string            `json:"title"`
+	Ext         string            `json:"ext"`
+	HTTPHeaders map[string]string `json:"http_headers"`
+}
+
+func (e *Extractor) Name() string { return "extractor" }
+
+func (e *Extractor) Match(u *url.URL) bool {
+	host := hostOf(u)
+	for _, pattern := range e.Hosts {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Extractor) Resolve(ctx context.Context, u *url.URL) (*Source, error) {
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	args := append([]string{}, e.Args...)
+	if e.Format != "" {
+		args = append(args, "-f", e.Format)
+	}
+	// "--" impede que a URL seja interpretada como opção do extrator
+	args = append(args, "--dump-json", "--no-playlist", "--", u.String())
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 5 * time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("extrator interrompido: %w", ctxErr)
+		}
+		return nil, fmt.Errorf("%w - %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseExtractorOutput(stdout.Bytes())
+}
+
+// parseExtractorOutput converte o JSON de --dump-json em uma Source.
+func parseExtractorOutput(data []byte) (*Source, error) {
+	var out extractorOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("decodificar saída do extrator: %w", err)
+	}
+	if out.URL == "" {
+		return nil, errors.New("o extrator não retornou uma URL direta (o formato escolhido separa áudio e vídeo?)")
+	}
+	direct, err := url.Parse(out.URL)
+	if err != nil {
+		return nil, fmt.Errorf("URL retornada pelo extrator é inválida: %w", err)
+	}
+
+	source := &Source{URL: direct, Header: make(http.Header)}
+	for key, value := range out.HTTPHeaders {
+		source.Header.Set(key, value)
+	}
+	if out.Title != "" && out.Ext != "" {
+		source.FileName = strings.ReplaceAll(out.Title, "/", "-") + "." + out.Ext
+	}
+	return source, nil
+}
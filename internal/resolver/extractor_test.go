@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseExtractorOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		wantURL  string
+		wantName string
+		wantUA   string
+		wantErr  bool
+	}{
+		{
+			name:     "formato único",
+			output:   `{"url":"https://rr1.googlevideo.com/videoplayback?id=1","title":"Aula 1/2","ext":"mp4","http_headers":{"User-Agent":"Mozilla/5.0"}}`,
+			wantURL:  "https://rr1.googlevideo.com/videoplayback?id=1",
+			wantName: "Aula 1-2.mp4",
+			wantUA:   "Mozilla/5.0",
+		},
+		{
+			name:    "sem título",
+			output:  `{"url":"https://cdn.example.com/v.mp4"}`,
+			wantURL: "https://cdn.example.com/v.mp4",
+		},
+		{
+			name:    "formatos separados, sem url",
+			output:  `{"title":"Aula","ext":"mp4","requested_formats":[{},{}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "JSON inválido",
+			output:  `ERROR: Unsupported URL`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := parseExtractorOutput([]byte(tt.output))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("esperado erro, veio %+v", source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source.URL.String() != tt.wantURL {
+				t.Errorf("URL = %s, esperado %s", source.URL, tt.wantURL)
+			}
+			if source.FileName != tt.wantName {
+				t.Errorf("FileName = %q, esperado %q", source.FileName, tt.wantName)
+			}
+			if got := source.Header.Get("User-Agent"); got != tt.wantUA {
+				t.Errorf("User-Agent = %q, esperado %q", got, tt.wantUA)
+			}
+		})
+	}
+}
+
+func TestExtractorRunsCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("usa um script de shell como extrator")
+	}
+	// O script devolve a URL recebida depois de "--", como o yt-dlp faria com um link direto
+	script := filepath.Join(t.TempDir(), "fake-yt-dlp")
+	body := "#!/bin/sh\nfor last; do :; done\nprintf '{\"url\":\"%s\",\"title\":\"video\",\"ext\":\"webm\"}' \"$last\"\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	extractor := &Extractor{Command: script, Hosts: []string{"*.youtube.com", "youtu.be"}}
+	page, _ := url.Parse("https://www.youtube.com/watch?v=abc")
+	if !extractor.Match(page) {
+		t.Fatal("Match deveria aceitar www.youtube.com")
+	}
+	if other, _ := url.Parse("https://youtube.com.evil.example/watch"); extractor.Match(other) {
+		t.Fatal("Match não deveria aceitar outro domínio")
+	}
+
+	source, err := extractor.Resolve(context.Background(), page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.URL.String() != page.String() || source.FileName != "video.webm" {
+		t.Fatalf("Resolve = %+v", source)
+	}
+}
@@ -0,0 +1,57 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Source is a direct media stream that can be fetched with a plain GET.
+type Source struct {
+	URL *url.URL
+	// FileName is the suggested name for the download, when the resolver knows it.
+	FileName string
+	// Header carries extra request headers some origins require (e.g. User-Agent).
+	Header http.Header
+	// Resolver names the resolver that produced the source; empty for direct links.
+	Resolver string
+}
+
+// Resolver turns a URL shape it recognises (share page, video page) into a
+// direct Source.
+type Resolver interface {
+	Name() string
+	Match(u *url.URL) bool
+	Resolve(ctx context.Context, u *url.URL) (*Source, error)
+}
+
+// Registry tries its resolvers in order; URLs no resolver matches are
+// returned unchanged, as direct links.
+type Registry struct {
+	resolvers []Resolver
+}
+
+func NewRegistry(resolvers ...Resolver) *Registry {
+	return &Registry{resolvers: resolvers}
+}
+
+// Default returns the registry with the built-in share-link resolvers.
+func Default() *Registry {
+	return NewRegistry(GoogleDrive{}, Dropbox{}, OneDrive{})
+}
+
+func (r *Registry) Resolve(ctx context.Context, u *url.URL) (*Source, error) {
+	for _, res := range r.resolvers {
+		if !res.Match(u) {
+			continue
+		}
+		source, err := res.Resolve(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", res.Name(), err)
+		}
+		source.Resolver = res.Name()
+		return source, nil
+	}
+	return &Source{URL: u}, nil
+}
@@ -0,0 +1,111 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var driveIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{10,}$`)
+
+// GoogleDrive converts Drive share links (/file/d/<id>/view, /open?id=,
+// /uc?id=) into the direct download endpoint. Files must be shared with
+// "anyone with the link".
+type GoogleDrive struct{}
+
+func (GoogleDrive) Name() string { return "google_drive" }
+
+func (GoogleDrive) Match(u *url.URL) bool {
+	host := hostOf(u)
+	return (host == "drive.google.com" || host == "docs.google.com") && driveFileID(u) != ""
+}
+
+func (GoogleDrive) Resolve(_ context.Context, u *url.URL) (*Source, error) {
+	id := driveFileID(u)
+	if id == "" {
+		return nil, errors.New("ID do arquivo não encontrado no link do Drive")
+	}
+	// confirm=t pula a página de aviso de antivírus exibida para arquivos grandes
+	direct := &url.URL{
+		Scheme:   "https",
+		Host:     "drive.usercontent.google.com",
+		Path:     "/download",
+		RawQuery: url.Values{"id": {id}, "export": {"download"}, "confirm": {"t"}}.Encode(),
+	}
+	return &Source{URL: direct}, nil
+}
+
+func driveFileID(u *url.URL) string {
+	var id string
+	if rest, ok := strings.CutPrefix(u.Path, "/file/d/"); ok {
+		id, _, _ = strings.Cut(rest, "/")
+	} else if u.Path == "/open" || u.Path == "/uc" {
+		id = u.Query().Get("id")
+	}
+	if !driveIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+// Dropbox switches file share links to dl=1, which answers with the file
+// itself instead of the preview page.
+type Dropbox struct{}
+
+func (Dropbox) Name() string { return "dropbox" }
+
+func (Dropbox) Match(u *url.URL) bool {
+	host := hostOf(u)
+	return (host == "dropbox.com" || host == "www.dropbox.com") &&
+		(strings.HasPrefix(u.Path, "/s/") || strings.HasPrefix(u.Path, "/scl/fi/"))
+}
+
+func (Dropbox) Resolve(_ context.Context, u *url.URL) (*Source, error) {
+	direct := *u
+	query := direct.Query()
+	query.Del("raw")
+	query.Set("dl", "1")
+	direct.RawQuery = query.Encode()
+	direct.Fragment = ""
+	return &Source{URL: &direct}, nil
+}
+
+// OneDrive resolves personal OneDrive links (1drv.ms, onedrive.live.com)
+// through the shares API and SharePoint/OneDrive for Business links with
+// download=1.
+type OneDrive struct{}
+
+func (OneDrive) Name() string { return "onedrive" }
+
+func (OneDrive) Match(u *url.URL) bool {
+	host := hostOf(u)
+	if host == "1drv.ms" || host == "onedrive.live.com" {
+		return true
+	}
+	// Links de compartilhamento do SharePoint têm o formato /:<tipo>:/...
+	return strings.HasSuffix(host, ".sharepoint.com") && strings.HasPrefix(u.Path, "/:")
+}
+
+func (OneDrive) Resolve(_ context.Context, u *url.URL) (*Source, error) {
+	if strings.HasSuffix(hostOf(u), ".sharepoint.com") {
+		direct := *u
+		query := direct.Query()
+		query.Set("download", "1")
+		direct.RawQuery = query.Encode()
+		direct.Fragment = ""
+		return &Source{URL: &direct}, nil
+	}
+
+	shareID := "u!" + base64.RawURLEncoding.EncodeToString([]byte(u.String()))
+	sharePath := "/v1.0/shares/" + shareID + "/root/content"
+	// RawPath mantém o "!" literal, como a API espera
+	direct := &url.URL{Scheme: "https", Host: "api.onedrive.com", Path: sharePath, RawPath: sharePath}
+	return &Source{URL: direct}, nil
+}
+
+func hostOf(u *url.URL) string {
+	return strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+}
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestShareResolvers(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		resolver string // vazio: link direto, sem resolver
+		want     string
+	}{
+		{
+			name:     "drive file view",
+			input:    "https://drive.google.com/file/d/1AbCdEfGhIjKlMnOp/view?usp=sharing",
+			resolver: "google_drive",
+			want:     "https://drive.usercontent.google.com/download?confirm=t&export=download&id=1AbCdEfGhIjKlMnOp",
+		},
+		{
+			name:     "drive open",
+			input:    "https://drive.google.com/open?id=1AbCdEfGhIjKlMnOp",
+			resolver: "google_drive",
+			want:     "https://drive.usercontent.google.com/download?confirm=t&export=download&id=1AbCdEfGhIjKlMnOp",
+		},
+		{
+			name:     "drive uc",
+			input:    "https://docs.google.com/uc?id=1AbCdEfGhIjKlMnOp&export=view",
+			resolver: "google_drive",
+			want:     "https://drive.usercontent.google.com/download?confirm=t&export=download&id=1AbCdEfGhIjKlMnOp",
+		},
+		{
+			name:  "drive sem ID válido",
+			input: "https://drive.google.com/drive/folders/xyz",
+			want:  "https://drive.google.com/drive/folders/xyz",
+		},
+		{
+			name:     "dropbox s",
+			input:    "https://www.dropbox.com/s/abc123/video.mp4?dl=0#frag",
+			resolver: "dropbox",
+			want:     "https://www.dropbox.com/s/abc123/video.mp4?dl=1",
+		},
+		{
+			name:     "dropbox scl com raw",
+			input:    "https://dropbox.com/scl/fi/abc/video.mp4?rlkey=k&raw=1",
+			resolver: "dropbox",
+			want:     "https://dropbox.com/scl/fi/abc/video.mp4?dl=1&rlkey=k",
+		},
+		{
+			name:     "onedrive pessoal",
+			input:    "https://1drv.ms/v/s!AkXyZ",
+			resolver: "onedrive",
+			want:     "https://api.onedrive.com/v1.0/shares/u!aHR0cHM6Ly8xZHJ2Lm1zL3YvcyFBa1h5Wg/root/content",
+		},
+		{
+			name:     "sharepoint",
+			input:    "https://contoso.sharepoint.com/:v:/g/personal/abc?e=xyz",
+			resolver: "onedrive",
+			want:     "https://contoso.sharepoint.com/:v:/g/personal/abc?download=1&e=xyz",
+		},
+		{
+			name:  "sharepoint fora de link de compartilhamento",
+			input: "https://contoso.sharepoint.com/sites/docs/video.mp4",
+			want:  "https://contoso.sharepoint.com/sites/docs/video.mp4",
+		},
+		{
+			name:  "link direto",
+			input: "https://cdn.example.com/video.mp4",
+			want:  "https://cdn.example.com/video.mp4",
+		},
+	}
+
+	registry := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			source, err := registry.Resolve(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if source.Resolver != tt.resolver {
+				t.Errorf("Resolver = %q, esperado %q", source.Resolver, tt.resolver)
+			}
+			if got := source.URL.String(); got != tt.want {
+				t.Errorf("URL = %s\nesperado %s", got, tt.want)
+			}
+		})
+	}
+}
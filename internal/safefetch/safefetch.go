@@ -0,0 +1,353 @@
+package safefetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const maxRedirects = 10
+
+// ErrBlocked is returned (wrapped) when a URL, redirect or resolved address
+// is not allowed by the policy.
+var ErrBlocked = errors.New("destino não permitido")
+
+// ErrIdleTimeout is returned by a response body that stopped delivering data
+// for longer than Timeouts.Idle.
+var ErrIdleTimeout = errors.New("download parado por tempo demais")
+
+// Faixas que nunca devem ser acessadas a partir de uma URL enviada pelo cliente.
+var blockedPrefixes = mustPrefixes(
+	"0.0.0.0/8",       // "esta" rede
+	"10.0.0.0/8",      // privada
+	"100.64.0.0/10",   // CGNAT (inclui o metadata da Alibaba Cloud)
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local (metadata da AWS, GCP e Azure)
+	"172.16.0.0/12",   // privada
+	"192.0.0.0/24",    // atribuições do IETF
+	"192.0.2.0/24",    // documentação
+	"192.168.0.0/16",  // privada
+	"198.18.0.0/15",   // benchmark
+	"198.51.100.0/24", // documentação
+	"203.0.113.0/24",  // documentação
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reservada e broadcast
+	"::/128",          // não especificado
+	"::1/128",         // loopback
+	"64:ff9b::/96",    // NAT64, pode apontar para IPv4 interno
+	"64:ff9b:1::/48",  // NAT64 local
+	"100::/64",        // descarte
+	"2001:db8::/32",   // documentação
+	"fc00::/7",        // ULA
+	"fe80::/10",       // link-local
+	"ff00::/8",        // multicast
+)
+
+// Config lists the exceptions to the built-in rules. Host entries are exact
+// names ("cdn.example.com") or subdomain wildcards ("*.example.com").
+type Config struct {
+	// AllowHosts, when not empty, is the only set of hosts that may be fetched.
+	AllowHosts []string
+	DenyHosts  []string
+	// AllowCIDRs re-enables ranges blocked by default, e.g. an internal media server.
+	AllowCIDRs []string
+	// DenyCIDRs blocks extra ranges; it takes precedence over AllowCIDRs.
+	DenyCIDRs []string
+}
+
+// Policy decides which URLs and addresses may be fetched. The zero Policy
+// applies only the built-in rules.
+type Policy struct {
+	allowHosts []string
+	denyHosts  []string
+	allowCIDRs []netip.Prefix
+	denyCIDRs  []netip.Prefix
+	// lookupIP resolve nomes em CheckHost; nil usa o resolver padrão.
+	lookupIP func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+func NewPolicy(cfg Config) (*Policy, error) {
+	p := &Policy{
+		allowHosts: normalizeHosts(cfg.AllowHosts),
+		denyHosts:  normalizeHosts(cfg.DenyHosts),
+	}
+	var err error
+	if p.allowCIDRs, err = parsePrefixes(cfg.AllowCIDRs); err != nil {
+		return nil, err
+	}
+	if p.denyCIDRs, err = parsePrefixes(cfg.DenyCIDRs); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CheckURL validates the parts of u known before connecting: scheme,
+// embedded credentials, host lists and literal IP addresses.
+func (p *Policy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: apenas URLs HTTP/HTTPS são permitidas", ErrBlocked)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: URL com credenciais embutidas", ErrBlocked)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("%w: URL sem host", ErrBlocked)
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrBlocked, host)
+	}
+	if matchHost(p.denyHosts, host) {
+		return fmt.Errorf("%w: host bloqueado %s", ErrBlocked, host)
+	}
+	if len(p.allowHosts) > 0 && !matchHost(p.allowHosts, host) {
+		return fmt.Errorf("%w: host fora da lista permitida %s", ErrBlocked, host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.CheckAddr(addr)
+	}
+	return nil
+}
+
+// CheckHost is CheckURL plus a DNS lookup of the host, rejecting names that
+// resolve to a blocked address. It is meant for URLs handed to code that
+// connects on its own (such as an external extractor) and therefore cannot
+// use the checks NewClient applies at dial time.
+func (p *Policy) CheckHost(ctx context.Context, u *url.URL) error {
+	if err := p.CheckURL(u); err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+	addrs, err := p.lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolver %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := p.CheckAddr(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Policy) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if p.lookupIP != nil {
+		return p.lookupIP(ctx, host)
+	}
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// CheckAddr validates an address the client is about to connect to.
+func (p *Policy) CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap().WithZone("")
+	if containsAddr(p.denyCIDRs, addr) {
+		return fmt.Errorf("%w: endereço bloqueado %s", ErrBlocked, addr)
+	}
+	if containsAddr(p.allowCIDRs, addr) {
+		return nil
+	}
+	if containsAddr(blockedPrefixes, addr) {
+		return fmt.Errorf("%w: endereço interno %s", ErrBlocked, addr)
+	}
+	return nil
+}
+
+// control roda depois da resolução de DNS e antes de cada conexão, então vale
+// para todos os IPs tentados e não pode ser contornado por DNS rebinding.
+func (p *Policy) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: endereço inválido %s", ErrBlocked, address)
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: endereço inválido %s", ErrBlocked, address)
+	}
+	return p.CheckAddr(addr)
+}
+
+// Timeouts bounds each phase of a download separately, so large files are
+// not cut off by a single total deadline.
+type Timeouts struct {
+	// Connect covers the TCP connection and the TLS handshake.
+	Connect time.Duration
+	// Header is the wait for the response headers after the request is sent.
+	Header time.Duration
+	// Idle is the longest the body may go without delivering any data.
+	Idle time.Duration
+}
+
+// NewClient returns an HTTP client that applies p to the initial URL, every
+// redirect hop and every address it connects to. Proxies from the
+// environment are ignored, since they would connect on the client's behalf.
+func NewClient(p *Policy, t Timeouts) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   t.Connect,
+		KeepAlive: 30 * time.Second,
+		Control:   p.control,
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   t.Connect,
+		ResponseHeaderTimeout: t.Header,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Transport: &checkedTransport{policy: p, idle: t.Idle, next: transport},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("redirecionamentos demais")
+			}
+			return p.CheckURL(req.URL)
+		},
+	}
+}
+
+// IsTimeout reports whether err comes from one of the client timeouts.
+func IsTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrIdleTimeout) || errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// checkedTransport valida a URL inicial, inclusive quando o cliente é usado
+// sem passar por CheckURL, e aplica o timeout de inatividade ao corpo.
+type checkedTransport struct {
+	policy *Policy
+	idle   time.Duration
+	next   http.RoundTripper
+}
+
+func (t *checkedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.CheckURL(req.URL); err != nil {
+		return nil, err
+	}
+	if t.idle <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	body := &idleBody{ReadCloser: resp.Body, idle: t.idle, cancel: cancel}
+	body.timer = time.AfterFunc(t.idle, func() {
+		body.expired.Store(true)
+		cancel()
+	})
+	resp.Body = body
+	return resp, nil
+}
+
+// idleBody cancela a requisição quando o corpo fica sem receber dados por mais que o
+// limite; cada leitura com dados reinicia a contagem.
+type idleBody struct {
+	io.ReadCloser
+	idle    time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	expired atomic.Bool
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.expired.Load() {
+		return n, ErrIdleTimeout
+	}
+	if n > 0 {
+		b.timer.Reset(b.idle)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func normalizeHosts(hosts []string) []string {
+	var normalized []string
+	for _, host := range hosts {
+		if host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), ".")); host != "" {
+			normalized = append(normalized, host)
+		}
+	}
+	return normalized
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("CIDR inválido %q: %w", value, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("CIDR inválido %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func mustPrefixes(values ...string) []netip.Prefix {
+	prefixes, err := parsePrefixes(values)
+	if err != nil {
+		panic(err)
+	}
+	return prefixes
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
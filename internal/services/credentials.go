@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+)
+
+// Modos de autenticação aceitos em DRIVE_AUTH_MODE e no header X-Drive-Auth-Mode.
+const (
+	AuthModeAccessToken    = "access_token"
+	AuthModeRefreshToken   = "refresh_token"
+	AuthModeServiceAccount = "service_account"
+)
+
+// CredentialProvider supplies the OAuth2 tokens used to call the Drive API.
+type CredentialProvider interface {
+	// Mode identifies the credential kind, for logging.
+	Mode() string
+	// Account identifies the Drive account the credentials act on, without
+	// revealing secrets. It is empty when the account is unknown.
+	Account() string
+	TokenSource(ctx context.Context) (oauth2.TokenSource, error)
+}
+
+// AccessTokenCredentials forwards a token obtained by the caller. It cannot
+// be refreshed, so uploads fail once the token expires (~1h). Subject is the
+// token's Google account, when it was verified.
+type AccessTokenCredentials struct {
+	AccessToken string
+	Subject     string
+}
+
+func (AccessTokenCredentials) Mode() string { return AuthModeAccessToken }
+
+func (c AccessTokenCredentials) Account() string {
+	if c.Subject == "" {
+		return ""
+	}
+	return "google:" + c.Subject
+}
+
+func (c AccessTokenCredentials) TokenSource(context.Context) (oauth2.TokenSource, error) {
+	if c.AccessToken == "" {
+		return nil, errors.New("token de acesso é obrigatório")
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.AccessToken}), nil
+}
+
+// RefreshTokenCredentials exchanges a long-lived refresh token for access
+// tokens as needed, so uploads may outlive a single access token.
+type RefreshTokenCredentials struct {
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+}
+
+func (RefreshTokenCredentials) Mode() string { return AuthModeRefreshToken }
+
+func (c RefreshTokenCredentials) Account() string {
+	if c.RefreshToken == "" {
+		return ""
+	}
+	return "refresh:" + digest(c.ClientID, c.RefreshToken)
+}
+
+func (c RefreshTokenCredentials) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if c.RefreshToken == "" {
+		return nil, errors.New("refresh token é obrigatório")
+	}
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return nil, errors.New("client ID e client secret do OAuth são obrigatórios para usar refresh token")
+	}
+
+	conf := &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Endpoint:     google.Endpoint,
+	}
+	return conf.TokenSource(ctx, &oauth2.Token{RefreshToken: c.RefreshToken}), nil
+}
+
+// ServiceAccountCredentials authenticates as a service account from its JSON
+// key. With Subject set, it impersonates that user through domain-wide
+// delegation, so files land in the user's Drive.
+type ServiceAccountCredentials struct {
+	JSONKey []byte
+	Subject string
+}
+
+func (ServiceAccountCredentials) Mode() string { return AuthModeServiceAccount }
+
+func (c ServiceAccountCredentials) Account() string {
+	if len(c.JSONKey) == 0 {
+		return ""
+	}
+	return "service_account:" + digest(string(c.JSONKey)) + ":" + c.Subject
+}
+
+func (c ServiceAccountCredentials) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if len(c.JSONKey) == 0 {
+		return nil, errors.New("chave JSON da service account não configurada")
+	}
+
+	conf, err := google.JWTConfigFromJSON(c.JSONKey, drive.DriveScope)
+	if err != nil {
+		return nil, fmt.Errorf("chave JSON da service account inválida: %w", err)
+	}
+	conf.Subject = c.Subject
+	return conf.TokenSource(ctx), nil
+}
+
+// digest resume segredos em um identificador estável que não os expõe.
+func digest(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,32 +12,39 @@ import (
 	"golang.org/x/oauth2"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
+
+	"upload-drive-script/pkg/logger"
 )
 
-func GetDriveClient(tokenString string) (*http.Client, error) {
-	if tokenString == "" {
-		return nil, fmt.Errorf("token de acesso é obrigatório")
+func GetDriveClient(ctx context.Context, creds CredentialProvider) (*http.Client, error) {
+	if creds == nil {
+		return nil, fmt.Errorf("credenciais do Drive não informadas")
 	}
 
-	token := &oauth2.Token{
-		AccessToken: tokenString,
+	source, err := creds.TokenSource(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(token)), nil
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, source)), nil
 }
 
-func GetDriveService(tokenString string) (*drive.Service, error) {
-	client, err := GetDriveClient(tokenString)
+func GetDriveService(ctx context.Context, creds CredentialProvider) (*drive.Service, error) {
+	client, err := GetDriveClient(ctx, creds)
 	if err != nil {
 		return nil, err
 	}
-	return drive.NewService(context.Background(), option.WithHTTPClient(client))
+	return drive.NewService(ctx, option.WithHTTPClient(client))
 }
 
-func UploadFile(tokenString string, filePath string, folderID string, fileName string) (string, error) {
-	srv, err := GetDriveService(tokenString)
+// UploadFile sends a local file to Drive through a resumable session. The
+// session URI is persisted so an interrupted upload resumes where it stopped,
+// even after a process restart.
+func UploadFile(ctx context.Context, creds CredentialProvider, filePath string, folderID string, fileName string, opts UploadOptions) (string, error) {
+	client, err := GetDriveClient(ctx, creds)
 	if err != nil {
 		return "", err
 	}
+	opts = opts.normalized()
 
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -44,46 +52,139 @@ func UploadFile(tokenString string, filePath string, folderID string, fileName s
 	}
 	defer f.Close()
 
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+
 	if fileName == "" {
 		fileName = filepath.Base(filePath)
 	}
 
-	file := &drive.File{
-		Name: fileName,
+	// Sem uma conta identificável a sessão não é persistida: a chave não
+	// distinguiria usuários que enviam o mesmo arquivo
+	var store sessionStore
+	if account := creds.Account(); account != "" {
+		store = newSessionStore()
 	}
-	if folderID != "" {
-		file.Parents = []string{folderID}
+	store.prune()
+
+	if opts.SHA256 == "" {
+		if opts.SHA256, err = fileSHA256(f); err != nil {
+			return "", err
+		}
+	}
+	key := sessionKey(creds.Account(), opts.SHA256, size, folderID, fileName)
+	unlock := store.lock(key)
+	defer unlock()
+
+	if sessionURI, ok := store.load(key); ok {
+		upload := &resumableUpload{client: client, sessionURI: sessionURI, opts: opts}
+		fileID, err := resumeFile(ctx, upload, f, size)
+		if err == nil {
+			store.remove(key)
+			return fileID, nil
+		}
+		if !errors.Is(err, ErrSessionExpired) {
+			return "", err
+		}
+		logger.Info("sessão resumable expirada para " + fileName + ", iniciando nova")
+		store.remove(key)
 	}
 
-	res, err := srv.Files.Create(file).
-		Media(f).
-		Do()
+	sessionURI, err := startResumableSession(ctx, client, newFileMetadata(folderID, fileName), size, "", opts)
 	if err != nil {
 		return "", err
 	}
+	if err := store.save(key, sessionURI); err != nil {
+		logger.Error("falha ao persistir sessão resumable: " + err.Error())
+	}
 
-	return res.Id, nil
+	upload := &resumableUpload{client: client, sessionURI: sessionURI, opts: opts}
+	fileID, err := upload.send(ctx, io.NewSectionReader(f, 0, size), 0, size)
+	if err != nil {
+		return "", err
+	}
+	store.remove(key)
+	return fileID, nil
 }
 
-func UploadFileStream(tokenString string, content io.Reader, folderID string, fileName string) (string, error) {
-	srv, err := GetDriveService(tokenString)
+func resumeFile(ctx context.Context, upload *resumableUpload, f *os.File, size int64) (string, error) {
+	fileID, committed, err := upload.status(ctx, size)
 	if err != nil {
 		return "", err
 	}
+	if fileID != "" {
+		return fileID, nil
+	}
+	logger.Info(fmt.Sprintf("retomando upload resumable a partir de %d/%d bytes", committed, size))
+	return upload.send(ctx, io.NewSectionReader(f, committed, size-committed), committed, size)
+}
 
-	file := &drive.File{
-		Name: fileName,
+// UploadFileStream sends content of unknown length to Drive in resumable
+// chunks. Each chunk is buffered in memory so it can be retried, but the
+// session cannot survive a restart because the source stream is gone.
+func UploadFileStream(ctx context.Context, creds CredentialProvider, content io.Reader, folderID string, fileName string, opts UploadOptions) (string, error) {
+	client, err := GetDriveClient(ctx, creds)
+	if err != nil {
+		return "", err
 	}
-	if folderID != "" {
-		file.Parents = []string{folderID}
+	opts = opts.normalized()
+
+	sessionURI, err := startResumableSession(ctx, client, newFileMetadata(folderID, fileName), -1, "", opts)
+	if err != nil {
+		return "", err
 	}
 
-	res, err := srv.Files.Create(file).
-		Media(content).
-		Do()
+	upload := &resumableUpload{client: client, sessionURI: sessionURI, opts: opts}
+	return upload.send(ctx, content, 0, -1)
+}
+
+// StartUploadSession opens a resumable session for a client that sends the
+// bytes itself, such as a browser. origin must be the browser's Origin so
+// Drive answers its CORS requests; size is -1 when unknown.
+func StartUploadSession(ctx context.Context, creds CredentialProvider, folderID, fileName, mimeType string, size int64, origin string) (string, error) {
+	client, err := GetDriveClient(ctx, creds)
 	if err != nil {
 		return "", err
 	}
+	meta := newFileMetadata(folderID, fileName)
+	meta.MimeType = mimeType
+	return startResumableSession(ctx, client, meta, size, origin, DefaultUploadOptions().normalized())
+}
+
+// UploadSessionStatus reports how far a session opened with
+// StartUploadSession got. fileID is set once Drive has the whole file;
+// until then committed is the number of bytes Drive persisted.
+func UploadSessionStatus(ctx context.Context, creds CredentialProvider, sessionURI string) (fileID string, committed int64, err error) {
+	client, err := GetDriveClient(ctx, creds)
+	if err != nil {
+		return "", 0, err
+	}
+	upload := &resumableUpload{client: client, sessionURI: sessionURI, opts: DefaultUploadOptions().normalized()}
+	return upload.status(ctx, -1)
+}
 
-	return res.Id, nil
+// GetFileInfo returns the name, MIME type, size, MD5 checksum and trashed
+// state of a Drive file.
+func GetFileInfo(ctx context.Context, creds CredentialProvider, fileID string) (*drive.File, error) {
+	srv, err := GetDriveService(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	return srv.Files.Get(fileID).Fields("id", "name", "mimeType", "size", "md5Checksum", "trashed").SupportsAllDrives(true).Context(ctx).Do()
+}
+
+// OpenFile streams the content of a Drive file. The caller closes it.
+func OpenFile(ctx context.Context, creds CredentialProvider, fileID string) (io.ReadCloser, error) {
+	srv, err := GetDriveService(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := srv.Files.Get(fileID).SupportsAllDrives(true).Context(ctx).Download()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
 }
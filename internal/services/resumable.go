@@ -0,0 +1,509 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"upload-drive-script/internal/config"
+)
+
+const (
+	driveResumableEndpoint = "https://www.googleapis.com/upload/drive/v3/files?uploadType=resumable&fields=id&supportsAllDrives=true"
+
+	// Drive exige que todo chunk, exceto o último, seja múltiplo de 256 KiB.
+	chunkGranularity = 256 << 10
+	maxBackoff       = 32 * time.Second
+)
+
+// ErrSessionExpired means Drive no longer knows the resumable session.
+var ErrSessionExpired = errors.New("sessão de upload resumable expirada")
+
+// ProgressFunc receives the number of bytes confirmed by Drive so far.
+// total is -1 while the final size is still unknown.
+type ProgressFunc func(sent, total int64)
+
+// UploadOptions controls chunking, retries and progress reporting of resumable uploads.
+type UploadOptions struct {
+	ChunkSize  int64
+	MaxRetries int
+	Progress   ProgressFunc
+	// SHA256 is the hex digest of the file, when the caller already has it.
+	// UploadFile uses it to key the persisted session and hashes the file otherwise.
+	SHA256 string
+}
+
+// DefaultUploadOptions returns the options configured through the environment.
+func DefaultUploadOptions() UploadOptions {
+	return UploadOptions{
+		ChunkSize:  config.DriveChunkSize(),
+		MaxRetries: config.DriveMaxRetries(),
+	}
+}
+
+func (o UploadOptions) normalized() UploadOptions {
+	if o.ChunkSize < chunkGranularity {
+		o.ChunkSize = chunkGranularity
+	}
+	o.ChunkSize -= o.ChunkSize % chunkGranularity
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	return o
+}
+
+type resumableUpload struct {
+	client     *http.Client
+	sessionURI string
+	opts       UploadOptions
+}
+
+type driveFileMetadata struct {
+	Name     string   `json:"name"`
+	MimeType string   `json:"mimeType,omitempty"`
+	Parents  []string `json:"parents,omitempty"`
+}
+
+func newFileMetadata(folderID, fileName string) driveFileMetadata {
+	meta := driveFileMetadata{Name: fileName}
+	if folderID != "" {
+		meta.Parents = []string{folderID}
+	}
+	return meta
+}
+
+// startResumableSession opens a Drive resumable session and returns its URI.
+// size may be -1 when the content length is unknown. origin, when set, is
+// sent so Drive accepts the session's chunks from that browser origin.
+func startResumableSession(ctx context.Context, client *http.Client, meta driveFileMetadata, size int64, origin string, opts UploadOptions) (string, error) {
+	body, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, driveResumableEndpoint, bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		if size >= 0 {
+			req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+		}
+		if meta.MimeType != "" {
+			req.Header.Set("X-Upload-Content-Type", meta.MimeType)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+
+		resp, err := client.Do(req)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			resp.Body.Close()
+			location := resp.Header.Get("Location")
+			if location == "" {
+				return "", errors.New("drive não retornou a URI da sessão resumable")
+			}
+			return location, nil
+		}
+
+		if !shouldRetry(ctx, resp, err) || attempt >= opts.MaxRetries {
+			return "", responseError("criar sessão resumable", resp, err)
+		}
+		drainAndClose(resp)
+		if err := sleepBackoff(ctx, attempt); err != nil {
+			return "", err
+		}
+	}
+}
+
+// send streams r to the session in chunks starting at offset. total is the
+// full content size or -1 when unknown.
+func (u *resumableUpload) send(ctx context.Context, r io.Reader, offset, total int64) (string, error) {
+	buf := make([]byte, u.opts.ChunkSize)
+
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		final := false
+		switch {
+		case readErr == io.EOF || readErr == io.ErrUnexpectedEOF:
+			final = true
+		case readErr != nil:
+			return "", fmt.Errorf("ler conteúdo para upload: %w", readErr)
+		}
+
+		chunkTotal := total
+		if final {
+			chunkTotal = offset + int64(n)
+		}
+
+		fileID, committed, err := u.putChunk(ctx, buf[:n], offset, chunkTotal)
+		if err != nil {
+			return "", err
+		}
+		if u.opts.Progress != nil {
+			u.opts.Progress(committed, chunkTotal)
+		}
+		if fileID != "" {
+			return fileID, nil
+		}
+		if final {
+			return "", errors.New("drive não confirmou a conclusão do upload")
+		}
+		offset = committed
+	}
+}
+
+// putChunk sends chunk (which starts at the absolute offset start), retrying
+// transient failures and resending whatever Drive did not acknowledge. The
+// retry budget is reset only when Drive confirms more bytes than before.
+func (u *resumableUpload) putChunk(ctx context.Context, chunk []byte, start, total int64) (string, int64, error) {
+	end := start + int64(len(chunk))
+	pos := start
+
+	attempt := 0
+	// advance move pos para o offset confirmado e diz se houve progresso
+	advance := func(committed int64) bool {
+		progressed := committed > pos
+		pos = committed
+		if progressed {
+			attempt = 0
+		}
+		return progressed
+	}
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.sessionURI, bytes.NewReader(chunk[pos-start:]))
+		if err != nil {
+			return "", 0, err
+		}
+		req.ContentLength = end - pos
+		req.Header.Set("Content-Range", contentRange(pos, end, total))
+
+		resp, err := u.client.Do(req)
+		if err == nil {
+			switch {
+			case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+				fileID, err := decodeFileID(resp)
+				return fileID, end, err
+			case resp.StatusCode == http.StatusPermanentRedirect:
+				committed := committedBytes(resp)
+				drainAndClose(resp)
+				if committed >= end {
+					return "", committed, nil
+				}
+				if committed < start {
+					return "", 0, fmt.Errorf("drive confirmou apenas %d bytes, esperado ao menos %d", committed, start)
+				}
+				// Aceite parcial não conta como falha: reenviamos o restante do chunk
+				if advance(committed) {
+					continue
+				}
+				// Sem progresso, o reenvio imediato poderia se repetir para sempre
+				if attempt >= u.opts.MaxRetries {
+					return "", 0, fmt.Errorf("enviar chunk: drive não confirmou bytes além de %d após %d tentativas", committed, attempt+1)
+				}
+				if err := sleepBackoff(ctx, attempt); err != nil {
+					return "", 0, err
+				}
+				attempt++
+				continue
+			case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+				drainAndClose(resp)
+				return "", 0, ErrSessionExpired
+			}
+		}
+
+		if !shouldRetry(ctx, resp, err) || attempt >= u.opts.MaxRetries {
+			return "", 0, responseError("enviar chunk", resp, err)
+		}
+		drainAndClose(resp)
+		if err := sleepBackoff(ctx, attempt); err != nil {
+			return "", 0, err
+		}
+		attempt++
+
+		fileID, committed, err := u.status(ctx, total)
+		if err != nil {
+			if errors.Is(err, ErrSessionExpired) {
+				return "", 0, err
+			}
+			continue
+		}
+		if fileID != "" {
+			return fileID, end, nil
+		}
+		if committed < start || committed > end {
+			return "", 0, fmt.Errorf("offset confirmado pelo drive (%d) fora do chunk atual", committed)
+		}
+		advance(committed)
+		if pos == end {
+			return "", committed, nil
+		}
+	}
+}
+
+// status asks Drive how many bytes of the session were persisted.
+func (u *resumableUpload) status(ctx context.Context, total int64) (string, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.sessionURI, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.ContentLength = 0
+	req.Header.Set("Content-Range", "bytes */"+sizeOrStar(total))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		fileID, err := decodeFileID(resp)
+		return fileID, 0, err
+	case http.StatusPermanentRedirect:
+		committed := committedBytes(resp)
+		drainAndClose(resp)
+		return "", committed, nil
+	case http.StatusNotFound, http.StatusGone:
+		drainAndClose(resp)
+		return "", 0, ErrSessionExpired
+	default:
+		return "", 0, responseError("consultar sessão resumable", resp, nil)
+	}
+}
+
+func contentRange(pos, end, total int64) string {
+	if pos == end {
+		return "bytes */" + sizeOrStar(total)
+	}
+	return fmt.Sprintf("bytes %d-%d/%s", pos, end-1, sizeOrStar(total))
+}
+
+func sizeOrStar(total int64) string {
+	if total < 0 {
+		return "*"
+	}
+	return strconv.FormatInt(total, 10)
+}
+
+// committedBytes parses the "Range: bytes=0-N" header of a 308 response.
+func committedBytes(resp *http.Response) int64 {
+	rng := resp.Header.Get("Range")
+	idx := strings.LastIndex(rng, "-")
+	if idx < 0 {
+		return 0
+	}
+	last, err := strconv.ParseInt(rng[idx+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return last + 1
+}
+
+func decodeFileID(resp *http.Response) (string, error) {
+	defer resp.Body.Close()
+
+	var payload struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("decodificar resposta do drive: %w", err)
+	}
+	if payload.ID == "" {
+		return "", errors.New("drive não retornou o ID do arquivo")
+	}
+	return payload.ID, nil
+}
+
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoffBase é a espera antes da primeira nova tentativa; os testes a reduzem.
+var backoffBase = time.Second
+
+func sleepBackoff(ctx context.Context, attempt int) error {
+	delay := backoffBase << attempt
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	delay += time.Duration(rand.Int64N(int64(backoffBase)))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func responseError(action string, resp *http.Response, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	return fmt.Errorf("%s: drive respondeu %d: %s", action, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func drainAndClose(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// sessionStore persists resumable session URIs on disk so uploads of local
+// files can continue after a process restart.
+type sessionStore struct {
+	dir string
+}
+
+type storedSession struct {
+	URI       string    `json:"uri"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Drive descarta sessões resumable não concluídas após uma semana.
+const sessionTTL = 7 * 24 * time.Hour
+
+var (
+	sessionLocksMu sync.Mutex
+	sessionLocks   = make(map[string]*sessionLock)
+)
+
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newSessionStore() sessionStore {
+	return sessionStore{dir: config.DriveSessionDir()}
+}
+
+// sessionKey identifica o envio pelo conteúdo e pelo destino, e não pelo
+// caminho na área de staging, que muda a cada recebimento. A conta entra na
+// chave para que uma sessão nunca seja retomada com as credenciais de outro usuário.
+func sessionKey(account, sha256Hex string, size int64, folderID, fileName string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		account,
+		sha256Hex,
+		strconv.FormatInt(size, 10),
+		folderID,
+		fileName,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func fileSHA256(f *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, 1<<62)); err != nil {
+		return "", fmt.Errorf("calcular hash do arquivo: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lock serializa envios com a mesma chave, que compartilhariam a sessão.
+func (s sessionStore) lock(key string) func() {
+	sessionLocksMu.Lock()
+	l, ok := sessionLocks[key]
+	if !ok {
+		l = &sessionLock{}
+		sessionLocks[key] = l
+	}
+	l.refs++
+	sessionLocksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		sessionLocksMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(sessionLocks, key)
+		}
+		sessionLocksMu.Unlock()
+	}
+}
+
+func (s sessionStore) load(key string) (string, bool) {
+	if s.dir == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, key+".json"))
+	if err != nil {
+		return "", false
+	}
+	var stored storedSession
+	if err := json.Unmarshal(data, &stored); err != nil || stored.URI == "" {
+		return "", false
+	}
+	if time.Since(stored.CreatedAt) > sessionTTL {
+		s.remove(key)
+		return "", false
+	}
+	return stored.URI, true
+}
+
+func (s sessionStore) save(key, uri string) error {
+	if s.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(storedSession{URI: uri, CreatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, key+".json"), data, 0o600)
+}
+
+func (s sessionStore) remove(key string) {
+	if s.dir == "" {
+		return
+	}
+	_ = os.Remove(filepath.Join(s.dir, key+".json"))
+}
+
+// prune remove as sessões expiradas ou ilegíveis.
+func (s sessionStore) prune() {
+	if s.dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		key, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if _, ok := s.load(key); !ok {
+			s.remove(key)
+		}
+	}
+}
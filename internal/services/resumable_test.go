@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSession imita uma sessão resumable do Drive: guarda os bytes recebidos
+// e responde 308 com o header Range até receber o conteúdo inteiro.
+type fakeSession struct {
+	mu       sync.Mutex
+	received []byte
+	// maxAccept limita quantos bytes de cada PUT são persistidos (0 = todos).
+	maxAccept int
+	// failAfterStore faz os próximos PUTs com dados persistirem o conteúdo e
+	// ainda assim responderem 503, como quando a resposta se perde.
+	failAfterStore int
+	// stall responde 308 sem aceitar nenhum byte novo.
+	stall bool
+	// expired responde com este status a qualquer requisição.
+	expired  int
+	requests []string
+}
+
+func newFakeSession(t *testing.T, f *fakeSession) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (f *fakeSession) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	contentRange := r.Header.Get("Content-Range")
+	f.requests = append(f.requests, contentRange)
+
+	if f.expired != 0 {
+		w.WriteHeader(f.expired)
+		return
+	}
+
+	var start, last, total int64
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	if rest, ok := strings.CutPrefix(spec, "*/"); ok {
+		// Consulta de status
+		fmt.Sscanf(rest, "%d", &total)
+		f.respond(w, total)
+		return
+	}
+	if _, err := fmt.Sscanf(spec, "%d-%d/%d", &start, &last, &total); err != nil || last-start+1 != int64(len(body)) {
+		http.Error(w, "Content-Range inválido: "+contentRange, http.StatusBadRequest)
+		return
+	}
+	if start != int64(len(f.received)) {
+		http.Error(w, fmt.Sprintf("offset %d, esperado %d", start, len(f.received)), http.StatusBadRequest)
+		return
+	}
+
+	if !f.stall {
+		if f.maxAccept > 0 && len(body) > f.maxAccept {
+			body = body[:f.maxAccept]
+		}
+		f.received = append(f.received, body...)
+	}
+	if f.failAfterStore > 0 {
+		f.failAfterStore--
+		http.Error(w, "backend error", http.StatusServiceUnavailable)
+		return
+	}
+	f.respond(w, total)
+}
+
+func (f *fakeSession) respond(w http.ResponseWriter, total int64) {
+	if int64(len(f.received)) == total {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"arquivo-1"}`)
+		return
+	}
+	if len(f.received) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(f.received)-1))
+	}
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+func (f *fakeSession) log() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func fastBackoff(t *testing.T) {
+	t.Helper()
+	previous := backoffBase
+	backoffBase = time.Millisecond
+	t.Cleanup(func() { backoffBase = previous })
+}
+
+func uploadContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func newTestUpload(srv *httptest.Server, opts UploadOptions) *resumableUpload {
+	return &resumableUpload{client: srv.Client(), sessionURI: srv.URL, opts: opts.normalized()}
+}
+
+func TestSendAcceptsPartialChunks(t *testing.T) {
+	content := uploadContent(600 << 10)
+	f := &fakeSession{maxAccept: 100 << 10}
+	srv := newFakeSession(t, f)
+
+	var progress []int64
+	upload := newTestUpload(srv, UploadOptions{
+		ChunkSize: chunkGranularity,
+		Progress:  func(sent, total int64) { progress = append(progress, sent) },
+	})
+	fileID, err := upload.send(context.Background(), bytes.NewReader(content), 0, int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileID != "arquivo-1" {
+		t.Errorf("fileID = %q", fileID)
+	}
+	if !bytes.Equal(f.received, content) {
+		t.Fatalf("drive recebeu %d bytes, esperado %d", len(f.received), len(content))
+	}
+	// Aceites parciais não consomem tentativas: MaxRetries é 0
+	if got := len(f.log()); got != 7 {
+		t.Errorf("%d requisições, esperado 7 (uma por aceite de 100 KiB)", got)
+	}
+	if want := []int64{256 << 10, 512 << 10, 600 << 10}; fmt.Sprint(progress) != fmt.Sprint(want) {
+		t.Errorf("progresso = %v, esperado %v", progress, want)
+	}
+}
+
+func TestSendQueriesStatusAfterServerError(t *testing.T) {
+	fastBackoff(t)
+	content := uploadContent(600 << 10)
+	f := &fakeSession{failAfterStore: 1}
+	srv := newFakeSession(t, f)
+
+	upload := newTestUpload(srv, UploadOptions{ChunkSize: chunkGranularity, MaxRetries: 2})
+	fileID, err := upload.send(context.Background(), bytes.NewReader(content), 0, int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileID != "arquivo-1" || !bytes.Equal(f.received, content) {
+		t.Fatalf("fileID = %q, drive recebeu %d bytes", fileID, len(f.received))
+	}
+
+	// Depois do 503 o cliente pergunta o offset em vez de reenviar o chunk
+	want := []string{
+		"bytes 0-262143/614400",
+		"bytes */614400",
+		"bytes 262144-524287/614400",
+		"bytes 524288-614399/614400",
+	}
+	if got := f.log(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("requisições = %q, esperado %q", got, want)
+	}
+}
+
+func TestSendSessionExpired(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			srv := newFakeSession(t, &fakeSession{expired: status})
+			upload := newTestUpload(srv, UploadOptions{MaxRetries: 3})
+
+			content := uploadContent(1000)
+			_, err := upload.send(context.Background(), bytes.NewReader(content), 0, int64(len(content)))
+			if !errors.Is(err, ErrSessionExpired) {
+				t.Fatalf("err = %v, esperado ErrSessionExpired", err)
+			}
+			if _, _, err := upload.status(context.Background(), int64(len(content))); !errors.Is(err, ErrSessionExpired) {
+				t.Fatalf("status: err = %v, esperado ErrSessionExpired", err)
+			}
+		})
+	}
+}
+
+func TestSendFailsWhenDriveNeverProgresses(t *testing.T) {
+	fastBackoff(t)
+	f := &fakeSession{stall: true}
+	srv := newFakeSession(t, f)
+	upload := newTestUpload(srv, UploadOptions{MaxRetries: 2})
+
+	content := uploadContent(1000)
+	done := make(chan error, 1)
+	go func() {
+		_, err := upload.send(context.Background(), bytes.NewReader(content), 0, int64(len(content)))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("send deveria falhar sem progresso do drive")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("send não terminou: 308 sem progresso repetido indefinidamente")
+	}
+	if got := len(f.log()); got != 3 {
+		t.Errorf("%d requisições, esperado 3 (a original e MaxRetries novas tentativas)", got)
+	}
+}
+
+func TestResumeStoredSession(t *testing.T) {
+	content := uploadContent(600 << 10)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// Antes da queda o drive já tinha persistido o primeiro chunk
+	f := &fakeSession{received: append([]byte(nil), content[:chunkGranularity]...)}
+	srv := newFakeSession(t, f)
+
+	sha, err := fileSHA256(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	key := sessionKey("google:pessoa", sha, int64(len(content)), "pasta", "video.mp4")
+	if err := (sessionStore{dir: dir}).save(key, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// Um novo processo encontra a sessão pela mesma chave
+	store := sessionStore{dir: dir}
+	if _, ok := store.load(sessionKey("google:outra", sha, int64(len(content)), "pasta", "video.mp4")); ok {
+		t.Fatal("sessão de outra conta não pode ser retomada")
+	}
+	uri, ok := store.load(key)
+	if !ok || uri != srv.URL {
+		t.Fatalf("load = %q, %v", uri, ok)
+	}
+
+	upload := &resumableUpload{client: srv.Client(), sessionURI: uri, opts: UploadOptions{ChunkSize: chunkGranularity}.normalized()}
+	fileID, err := resumeFile(context.Background(), upload, file, int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileID != "arquivo-1" || !bytes.Equal(f.received, content) {
+		t.Fatalf("fileID = %q, drive recebeu %d bytes", fileID, len(f.received))
+	}
+	want := []string{
+		"bytes */614400",
+		"bytes 262144-524287/614400",
+		"bytes 524288-614399/614400",
+	}
+	if got := f.log(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("requisições = %q, esperado %q", got, want)
+	}
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"upload-drive-script/pkg/logger"
+)
+
+// RefTracker counts in-flight references to stored files so the janitor
+// never evicts something that is still being written or served.
+type RefTracker struct {
+	mu   sync.Mutex
+	refs map[string]int
+}
+
+func NewRefTracker() *RefTracker {
+	return &RefTracker{refs: make(map[string]int)}
+}
+
+// Acquire marks name as in use until the returned release func is called.
+// On a nil tracker it does nothing.
+func (t *RefTracker) Acquire(name string) (release func()) {
+	if t == nil {
+		return func() {}
+	}
+	t.mu.Lock()
+	t.refs[name]++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.refs[name] <= 1 {
+				delete(t.refs, name)
+				return
+			}
+			t.refs[name]--
+		})
+	}
+}
+
+func (t *RefTracker) InUse(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.refs[name] > 0
+}
+
+// RetentionPolicy limits what the janitor keeps. Zero values disable a limit.
+type RetentionPolicy struct {
+	MaxAge        time.Duration
+	MaxTotalBytes int64
+	MaxFiles      int
+}
+
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxTotalBytes > 0 || p.MaxFiles > 0
+}
+
+// Janitor periodically evicts stored files, oldest first, until the backend
+// satisfies the retention policy.
+type Janitor struct {
+	backend Backend
+	policy  RetentionPolicy
+	refs    *RefTracker
+}
+
+func NewJanitor(backend Backend, policy RetentionPolicy, refs *RefTracker) *Janitor {
+	return &Janitor{backend: backend, policy: policy, refs: refs}
+}
+
+// Run sweeps every interval until ctx is cancelled.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.Sweep(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("janitor: " + err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep applies the policy once and returns the evicted files. Each HLS
+// package under StreamsPrefix is a single unit: it ages with its newest file,
+// counts as one file and is kept or evicted as a whole.
+func (j *Janitor) Sweep(ctx context.Context) ([]ObjectInfo, error) {
+	objects, err := j.backend.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listar arquivos: %w", err)
+	}
+
+	units := groupRetentionUnits(objects)
+	sort.Slice(units, func(a, b int) bool {
+		return units[a].modTime.Before(units[b].modTime)
+	})
+
+	var totalBytes int64
+	for _, unit := range units {
+		totalBytes += unit.size
+	}
+	count := len(units)
+	now := time.Now()
+
+	var removed []ObjectInfo
+	for _, unit := range units {
+		expired := j.policy.MaxAge > 0 && now.Sub(unit.modTime) > j.policy.MaxAge
+		overBytes := j.policy.MaxTotalBytes > 0 && totalBytes > j.policy.MaxTotalBytes
+		overCount := j.policy.MaxFiles > 0 && count > j.policy.MaxFiles
+		if !expired && !overBytes && !overCount {
+			// As demais unidades são mais novas e os limites já foram atendidos
+			break
+		}
+
+		if j.inUse(unit) {
+			continue
+		}
+
+		deleted := j.evict(ctx, unit)
+		removed = append(removed, deleted...)
+		for _, obj := range deleted {
+			totalBytes -= obj.Size
+		}
+		if len(deleted) == len(unit.objects) {
+			count--
+		}
+	}
+
+	return removed, nil
+}
+
+// retentionUnit é o que o janitor mantém ou remove de uma vez: um arquivo
+// avulso ou todos os arquivos de um pacote HLS.
+type retentionUnit struct {
+	name    string
+	objects []ObjectInfo
+	size    int64
+	modTime time.Time // do arquivo mais recente
+}
+
+func groupRetentionUnits(objects []ObjectInfo) []*retentionUnit {
+	var units []*retentionUnit
+	byName := make(map[string]*retentionUnit)
+	for _, obj := range objects {
+		name := retentionUnitName(obj.Name)
+		unit, ok := byName[name]
+		if !ok {
+			unit = &retentionUnit{name: name}
+			byName[name] = unit
+			units = append(units, unit)
+		}
+		unit.objects = append(unit.objects, obj)
+		unit.size += obj.Size
+		if obj.ModTime.After(unit.modTime) {
+			unit.modTime = obj.ModTime
+		}
+	}
+
+	for _, unit := range units {
+		// As playlists saem primeiro, para que o pacote deixe de ser
+		// acessível antes de perder os segmentos
+		sort.SliceStable(unit.objects, func(a, b int) bool {
+			return path.Ext(unit.objects[a].Name) == ".m3u8" && path.Ext(unit.objects[b].Name) != ".m3u8"
+		})
+	}
+	return units
+}
+
+// retentionUnitName devolve "streams/<id>" para arquivos de um pacote HLS e
+// o próprio nome para os demais.
+func retentionUnitName(name string) string {
+	rest, ok := strings.CutPrefix(name, StreamsPrefix+"/")
+	if !ok {
+		return name
+	}
+	id, _, ok := strings.Cut(rest, "/")
+	if !ok || id == "" {
+		return name
+	}
+	return StreamsPrefix + "/" + id
+}
+
+// inUse considera o pacote em uso quando qualquer arquivo dele, ou o próprio
+// pacote enquanto é gravado, tem referências.
+func (j *Janitor) inUse(unit *retentionUnit) bool {
+	if j.refs == nil {
+		return false
+	}
+	if j.refs.InUse(unit.name) {
+		return true
+	}
+	for _, obj := range unit.objects {
+		if j.refs.InUse(obj.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// evict remove os arquivos da unidade e devolve os que foram removidos.
+func (j *Janitor) evict(ctx context.Context, unit *retentionUnit) []ObjectInfo {
+	var deleted []ObjectInfo
+	for _, obj := range unit.objects {
+		if err := j.backend.Delete(ctx, obj.Name); err != nil {
+			if !errors.Is(err, ErrNotExist) {
+				logger.Error(fmt.Sprintf("janitor: falha ao remover %s: %v", obj.Name, err))
+				continue
+			}
+		}
+		deleted = append(deleted, obj)
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	if len(unit.objects) == 1 && unit.objects[0].Name == unit.name {
+		logger.Info(fmt.Sprintf("janitor: removido %s (%d bytes, modificado em %s)", unit.name, unit.size, unit.modTime.Format(time.RFC3339)))
+		return deleted
+	}
+
+	var bytes int64
+	for _, obj := range deleted {
+		bytes += obj.Size
+	}
+	logger.Info(fmt.Sprintf("janitor: removido pacote %s (%d de %d arquivos, %d bytes, modificado em %s)", unit.name, len(deleted), len(unit.objects), bytes, unit.modTime.Format(time.RFC3339)))
+	return deleted
+}
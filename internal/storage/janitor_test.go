@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newJanitorBackend grava os arquivos com as idades indicadas.
+func newJanitorBackend(t *testing.T, files map[string]time.Duration) *Local {
+	t.Helper()
+	backend, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now()
+	for name, age := range files {
+		if err := backend.Put(ctx, name, strings.NewReader("0123456789"), 10); err != nil {
+			t.Fatalf("Put %s: %v", name, err)
+		}
+		p, err := backend.Path(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-age)
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return backend
+}
+
+func listNames(t *testing.T, backend Backend) []string {
+	t.Helper()
+	objects, err := backend.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestJanitorEvictsStreamsAsOneUnit(t *testing.T) {
+	const (
+		oldPackage = "streams/00000000000000000000000000000001"
+		newPackage = "streams/00000000000000000000000000000002"
+	)
+	files := map[string]time.Duration{
+		// Pacote antigo: todos os arquivos passaram da idade máxima
+		oldPackage + "/index.m3u8":  3 * time.Hour,
+		oldPackage + "/segment0.ts": 3 * time.Hour,
+		oldPackage + "/segment1.ts": 3 * time.Hour,
+		// Pacote com segmentos antigos, mas gravado até pouco tempo atrás
+		newPackage + "/segment0.ts": 3 * time.Hour,
+		newPackage + "/segment1.ts": 3 * time.Hour,
+		newPackage + "/index.m3u8":  time.Minute,
+		"video.mp4":                 2 * time.Hour,
+		"audio.mp3":                 time.Minute,
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		kept   []string
+	}{
+		{
+			name:   "idade máxima usa o arquivo mais novo do pacote",
+			policy: RetentionPolicy{MaxAge: time.Hour},
+			kept: []string{
+				"audio.mp3",
+				newPackage + "/index.m3u8",
+				newPackage + "/segment0.ts",
+				newPackage + "/segment1.ts",
+			},
+		},
+		{
+			name:   "cada pacote conta como um arquivo",
+			policy: RetentionPolicy{MaxFiles: 4},
+			kept:   slices.Collect(maps.Keys(files)),
+		},
+		{
+			name:   "pacote mais antigo sai inteiro",
+			policy: RetentionPolicy{MaxFiles: 3},
+			kept: []string{
+				"audio.mp3",
+				newPackage + "/index.m3u8",
+				newPackage + "/segment0.ts",
+				newPackage + "/segment1.ts",
+				"video.mp4",
+			},
+		},
+		{
+			name:   "tamanho total soma os arquivos do pacote",
+			policy: RetentionPolicy{MaxTotalBytes: 40},
+			kept: []string{
+				"audio.mp3",
+				newPackage + "/index.m3u8",
+				newPackage + "/segment0.ts",
+				newPackage + "/segment1.ts",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newJanitorBackend(t, files)
+			removed, err := NewJanitor(backend, tt.policy, NewRefTracker()).Sweep(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			kept := listNames(t, backend)
+			slices.Sort(tt.kept)
+			if !slices.Equal(kept, tt.kept) {
+				t.Errorf("mantidos = %v, esperado %v", kept, tt.kept)
+			}
+			if len(removed)+len(kept) != len(files) {
+				t.Errorf("Sweep devolveu %d removidos para %d arquivos apagados", len(removed), len(files)-len(kept))
+			}
+		})
+	}
+}
+
+func TestJanitorKeepsStreamInUse(t *testing.T) {
+	const pkg = "streams/00000000000000000000000000000001"
+	files := map[string]time.Duration{
+		pkg + "/index.m3u8":  3 * time.Hour,
+		pkg + "/segment0.ts": 3 * time.Hour,
+		pkg + "/segment1.ts": 3 * time.Hour,
+	}
+	policy := RetentionPolicy{MaxAge: time.Hour}
+
+	for _, ref := range []string{pkg + "/segment1.ts", pkg} {
+		t.Run(ref, func(t *testing.T) {
+			backend := newJanitorBackend(t, files)
+			refs := NewRefTracker()
+			release := refs.Acquire(ref)
+
+			removed, err := NewJanitor(backend, policy, refs).Sweep(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(removed) != 0 {
+				t.Fatalf("pacote em uso teve arquivos removidos: %v", removed)
+			}
+
+			release()
+			removed, err = NewJanitor(backend, policy, refs).Sweep(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(removed) != len(files) || removed[0].Name != pkg+"/index.m3u8" {
+				t.Fatalf("removidos = %v, esperado o pacote inteiro começando pela playlist", removed)
+			}
+		})
+	}
+}
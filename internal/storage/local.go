@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local keeps files in a directory of the local filesystem.
+type Local struct {
+	dir string
+}
+
+// NewLocal creates dir if needed and returns a backend rooted at it.
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("preparar diretório de upload: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+// Path returns the location on disk of name, allowing callers to serve it
+// directly with sendfile-friendly helpers.
+func (l *Local) Path(name string) (string, error) {
+	cleaned, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(cleaned)), nil
+}
+
+func (l *Local) Put(_ context.Context, name string, r io.Reader, _ int64) error {
+	dst, err := l.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".put-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	// Link, ao contrário de Rename, falha se o destino já existe
+	err = os.Link(tmp.Name(), dst)
+	_ = os.Remove(tmp.Name())
+	if errors.Is(err, fs.ErrExist) {
+		return ErrExist
+	}
+	return err
+}
+
+func (l *Local) Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	info, err := l.Stat(ctx, name)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	rc, err := l.OpenRange(ctx, name, 0, -1)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return rc, info, nil
+}
+
+func (l *Local) Stat(_ context.Context, name string) (ObjectInfo, error) {
+	p, err := l.Path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return ObjectInfo{}, ErrNotExist
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, ErrNotExist
+	}
+	return ObjectInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) Delete(_ context.Context, name string) error {
+	p, err := l.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); errors.Is(err, os.ErrNotExist) {
+		return ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// List walks the directory recursively, skipping hidden entries such as the
+// staging area.
+func (l *Local) List(_ context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == l.dir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{
+			Name:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return objects, err
+}
+
+func (l *Local) OpenRange(_ context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	p, err := l.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+// importFile moves srcPath into the directory, refusing to overwrite.
+func (l *Local) importFile(_ context.Context, name, srcPath string) error {
+	dst, err := l.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	// Link falha se o destino existir, o que torna a reserva do nome atômica
+	if err := os.Link(srcPath, dst); err == nil {
+		return os.Remove(srcPath)
+	} else if errors.Is(err, os.ErrExist) {
+		return ErrExist
+	}
+
+	return copyExclusive(srcPath, dst)
+}
+
+func copyExclusive(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return ErrExist
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
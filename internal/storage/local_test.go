@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalPutDoesNotOverwrite(t *testing.T) {
+	backend, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := backend.Put(ctx, "streams/abc/index.m3u8", strings.NewReader("primeiro"), 8); err != nil {
+		t.Fatalf("primeiro Put: %v", err)
+	}
+	if err := backend.Put(ctx, "streams/abc/index.m3u8", strings.NewReader("segundo!"), 8); !errors.Is(err, ErrExist) {
+		t.Fatalf("segundo Put = %v, esperado ErrExist", err)
+	}
+
+	rc, _, err := backend.Get(ctx, "streams/abc/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); string(data) != "primeiro" {
+		t.Fatalf("conteúdo sobrescrito: %q", data)
+	}
+}
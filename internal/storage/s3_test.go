@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a MinIO-style stand-in: an in-memory bucket that speaks the
+// subset of the S3 REST API used by the S3 backend.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	// staleHeads makes the next HEADs on existing keys answer 404, simulating
+	// another replica writing between UniqueName and Put.
+	staleHeads int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3) {
+	t.Helper()
+	fake := &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	backend, err := NewS3(S3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "bucket",
+		Prefix:          "copies",
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio-secret",
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, backend
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/bucket/")
+	if !ok && r.URL.Path != "/bucket" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		f.list(w, query.Get("prefix"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		var number int
+		fmt.Sscan(query.Get("partNumber"), &number)
+		parts[number], _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		if f.rejectExisting(w, r, key) {
+			return
+		}
+		numbers := make([]int, 0, len(parts))
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var data []byte
+		for _, number := range numbers {
+			data = append(data, parts[number]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		if f.rejectExisting(w, r, key) {
+			return
+		}
+		f.objects[key], _ = io.ReadAll(r.Body)
+	case r.Method == http.MethodHead, r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if ok && r.Method == http.MethodHead && f.staleHeads > 0 {
+			f.staleHeads--
+			ok = false
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			http.ServeContent(w, r, key, time.Now(), strings.NewReader(string(data)))
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) rejectExisting(w http.ResponseWriter, r *http.Request, key string) bool {
+	if _, exists := f.objects[key]; exists && r.Header.Get("If-None-Match") == "*" {
+		http.Error(w, "PreconditionFailed", http.StatusPreconditionFailed)
+		return true
+	}
+	return false
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	}
+	var result struct {
+		XMLName  xml.Name  `xml:"ListBucketResult"`
+		Contents []content `xml:"Contents"`
+	}
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{Key: key, Size: int64(len(data)), LastModified: time.Now().UTC()})
+		}
+	}
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	fake, backend := newFakeS3(t)
+	ctx := context.Background()
+
+	if err := backend.Put(ctx, "video.mp4", strings.NewReader("conteudo"), 8); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, ok := fake.objects["copies/video.mp4"]; !ok {
+		t.Fatalf("objeto não gravado com o prefixo: %v", fake.objects)
+	}
+
+	info, err := backend.Stat(ctx, "video.mp4")
+	if err != nil || info.Size != 8 {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+
+	rc, err := backend.OpenRange(ctx, "video.mp4", 2, 3)
+	if err != nil {
+		t.Fatalf("OpenRange: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "nte" {
+		t.Fatalf("OpenRange = %q", data)
+	}
+
+	objects, err := backend.List(ctx)
+	if err != nil || len(objects) != 1 || objects[0].Name != "video.mp4" {
+		t.Fatalf("List = %+v, %v", objects, err)
+	}
+
+	if err := backend.Delete(ctx, "video.mp4"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := backend.Stat(ctx, "video.mp4"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Stat após Delete = %v, esperado ErrNotExist", err)
+	}
+}
+
+func TestS3PutDoesNotOverwrite(t *testing.T) {
+	_, backend := newFakeS3(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		size int64 // -1 força o multipart upload
+	}{
+		{"put simples", 8},
+		{"multipart", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := strings.ReplaceAll(tt.name, " ", "-") + ".mp4"
+			if err := backend.Put(ctx, name, strings.NewReader("primeiro"), tt.size); err != nil {
+				t.Fatalf("primeiro Put: %v", err)
+			}
+			err := backend.Put(ctx, name, strings.NewReader("segundo!"), tt.size)
+			if !errors.Is(err, ErrExist) {
+				t.Fatalf("segundo Put = %v, esperado ErrExist", err)
+			}
+
+			rc, _, err := backend.Get(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(data) != "primeiro" {
+				t.Fatalf("conteúdo sobrescrito: %q", data)
+			}
+		})
+	}
+}
+
+func TestStoreRetriesWhenS3NameIsTakenConcurrently(t *testing.T) {
+	fake, backend := newFakeS3(t)
+	ctx := context.Background()
+
+	if err := backend.Put(ctx, "video.mp4", strings.NewReader("outra réplica"), 14); err != nil {
+		t.Fatal(err)
+	}
+	// UniqueName ainda não vê o objeto gravado pela outra réplica
+	fake.staleHeads = 1
+
+	src := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(src, []byte("esta réplica"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	refs := NewRefTracker()
+	name, release, err := Store(ctx, backend, refs, "video.mp4", src)
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if name != "video-1.mp4" {
+		t.Fatalf("Store = %q, esperado video-1.mp4", name)
+	}
+	// Só o nome final continua em uso, até o chamador liberá-lo
+	if refs.InUse("video.mp4") || !refs.InUse("video-1.mp4") {
+		t.Fatal("Store deveria manter em uso apenas o nome final")
+	}
+	release()
+	if refs.InUse("video-1.mp4") {
+		t.Fatal("release não liberou o nome final")
+	}
+	if string(fake.objects["copies/video.mp4"]) != "outra réplica" {
+		t.Fatal("o objeto da outra réplica foi sobrescrito")
+	}
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"upload-drive-script/internal/config"
+)
+
+// StreamsPrefix is the directory holding HLS packages, one per
+// "streams/<id>/" subdirectory. The janitor evicts each package as a unit.
+const StreamsPrefix = "streams"
+
+var (
+	ErrNotExist    = errors.New("arquivo não encontrado")
+	ErrExist       = errors.New("arquivo já existe")
+	ErrInvalidName = errors.New("nome de arquivo inválido")
+)
+
+// ObjectInfo describes a stored file.
+type ObjectInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Backend stores the copies served from /uploads. Names are slash separated
+// relative paths; implementations must reject anything escaping their root.
+type Backend interface {
+	// Put never overwrites: it fails with ErrExist when name is taken.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error)
+	Stat(ctx context.Context, name string) (ObjectInfo, error)
+	Delete(ctx context.Context, name string) error
+	List(ctx context.Context) ([]ObjectInfo, error)
+	// OpenRange returns length bytes starting at offset; a negative length
+	// reads until the end of the file.
+	OpenRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+}
+
+// fileImporter is implemented by backends that can adopt a local file
+// without copying it. It must fail with ErrExist instead of overwriting.
+type fileImporter interface {
+	importFile(ctx context.Context, name, srcPath string) error
+}
+
+// NewFromConfig builds the backend selected by STORAGE_BACKEND.
+func NewFromConfig() (Backend, error) {
+	switch backend := strings.ToLower(config.StorageBackend()); backend {
+	case "", "local":
+		return NewLocal(config.UploadDir())
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        config.S3Endpoint(),
+			Region:          config.S3Region(),
+			Bucket:          config.S3Bucket(),
+			Prefix:          config.S3Prefix(),
+			AccessKeyID:     config.S3AccessKeyID(),
+			SecretAccessKey: config.S3SecretAccessKey(),
+			PathStyle:       config.S3PathStyle(),
+		})
+	default:
+		return nil, fmt.Errorf("backend de armazenamento desconhecido: %s", backend)
+	}
+}
+
+// Store moves the local file at srcPath into b using preferredName, or a
+// "-N" suffixed variant when that name is taken. It returns the final name
+// and a release func for the reference taken on it in refs before the write,
+// so the janitor never evicts the file between the write and its use. The
+// caller must call release once it no longer needs the file; on error there
+// is nothing to release.
+func Store(ctx context.Context, b Backend, refs *RefTracker, preferredName, srcPath string) (string, func(), error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		name, err := UniqueName(ctx, b, preferredName)
+		if err != nil {
+			return "", nil, err
+		}
+
+		release := refs.Acquire(name)
+		err = putFile(ctx, b, name, srcPath)
+		if errors.Is(err, ErrExist) {
+			// Outra requisição reservou o mesmo nome entre a checagem e a gravação
+			release()
+			continue
+		}
+		if err != nil {
+			release()
+			return "", nil, err
+		}
+		return name, release, nil
+	}
+	return "", nil, fmt.Errorf("não foi possível reservar um nome para %s", preferredName)
+}
+
+// StoreTree moves every file under srcDir into b below prefix, keeping the
+// relative paths. It returns the stored names, including on error, so the
+// caller can roll back.
+func StoreTree(ctx context.Context, b Backend, prefix, srcDir string) ([]string, error) {
+	var stored []string
+	err := filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		if err := putFile(ctx, b, name, p); err != nil {
+			return fmt.Errorf("gravar %s: %w", name, err)
+		}
+		stored = append(stored, name)
+		return nil
+	})
+	return stored, err
+}
+
+func putFile(ctx context.Context, b Backend, name, srcPath string) error {
+	if importer, ok := b.(fileImporter); ok {
+		return importer.importFile(ctx, name, srcPath)
+	}
+
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = b.Put(ctx, name, f, info.Size())
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(srcPath)
+}
+
+// UniqueName returns name if it is free in b, otherwise the first free
+// "base-N.ext" candidate.
+func UniqueName(ctx context.Context, b Backend, name string) (string, error) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+
+	for counter := 1; ; counter++ {
+		_, err := b.Stat(ctx, candidate)
+		if errors.Is(err, ErrNotExist) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s-%d%s", base, counter, ext)
+	}
+}
+
+// cleanName validates a backend object name.
+func cleanName(name string) (string, error) {
+	name = strings.TrimPrefix(strings.ReplaceAll(name, "\\", "/"), "/")
+	if name == "" || strings.ContainsRune(name, 0) {
+		return "", ErrInvalidName
+	}
+	cleaned := path.Clean(name)
+	if cleaned != name || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrInvalidName
+	}
+	return cleaned, nil
+}
+
+// rangeReadSeeker adapts OpenRange to io.ReadSeeker so any backend can be
+// served with http.ServeContent, including Range requests.
+type rangeReadSeeker struct {
+	ctx    context.Context
+	b      Backend
+	name   string
+	size   int64
+	offset int64
+	rc     io.ReadCloser
+}
+
+// NewReadSeeker returns a lazily opened io.ReadSeekCloser over name.
+func NewReadSeeker(ctx context.Context, b Backend, name string, size int64) io.ReadSeekCloser {
+	return &rangeReadSeeker{ctx: ctx, b: b, name: name, size: size}
+}
+
+func (r *rangeReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil {
+		rc, err := r.b.OpenRange(r.ctx, r.name, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+	n, err := r.rc.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.offset + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, errors.New("whence inválido")
+	}
+	if next < 0 {
+		return 0, errors.New("posição negativa")
+	}
+	if next != r.offset && r.rc != nil {
+		r.rc.Close()
+		r.rc = nil
+	}
+	r.offset = next
+	return next, nil
+}
+
+func (r *rangeReadSeeker) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	return r.rc.Close()
+}
@@ -0,0 +1,52 @@
+package tus
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ParseMetadata decodes an Upload-Metadata header: comma-separated pairs of
+// a key and its base64 value; the value may be omitted.
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for pair := range strings.SplitSeq(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		if key == "" || strings.ContainsAny(key, " ,") {
+			return nil, fmt.Errorf("chave inválida em Upload-Metadata: %q", key)
+		}
+		if _, dup := metadata[key]; dup {
+			return nil, fmt.Errorf("chave repetida em Upload-Metadata: %q", key)
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("valor de %q em Upload-Metadata não é base64 válido", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// EncodeMetadata is the inverse of ParseMetadata, with keys sorted.
+func EncodeMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if metadata[key] == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,281 @@
+// Package tus keeps the server-side state of tus 1.0 resumable uploads
+// (https://tus.io/protocols/resumable-upload): each upload is a <id>.bin data
+// file plus a <id>.info JSON file, so uploads survive a restart.
+package tus
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the protocol version implemented by this package.
+const Version = "1.0.0"
+
+var (
+	ErrNotFound       = errors.New("upload não encontrado")
+	ErrExpired        = errors.New("upload expirado")
+	ErrLocked         = errors.New("upload em uso por outra requisição")
+	ErrOffsetMismatch = errors.New("Upload-Offset não corresponde aos bytes recebidos")
+	ErrExceedsLength  = errors.New("dados além do Upload-Length")
+)
+
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Info is the persisted state of an upload.
+type Info struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// JobID is set once the complete file has been handed off for processing.
+	JobID     string    `json:"job_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Complete reports whether every byte of the upload has been received.
+func (i Info) Complete() bool { return i.Offset == i.Length }
+
+// Store keeps uploads in a directory. Writes to one upload must hold its
+// Lock; reads may happen concurrently.
+type Store struct {
+	dir string
+	// ttl is how long an upload is kept after its last write.
+	ttl time.Duration
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func NewStore(dir string, ttl time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, ttl: ttl, busy: make(map[string]bool)}, nil
+}
+
+// Create registers an upload of length bytes and creates its empty data file.
+func (s *Store) Create(length int64, metadata map[string]string) (Info, error) {
+	s.sweep()
+
+	id, err := newID()
+	if err != nil {
+		return Info{}, err
+	}
+	now := time.Now()
+	info := Info{ID: id, Length: length, Metadata: metadata, CreatedAt: now, ExpiresAt: s.expiry(now)}
+
+	f, err := os.OpenFile(s.DataPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return Info{}, err
+	}
+	f.Close()
+	if err := s.save(info); err != nil {
+		_ = os.Remove(s.DataPath(id))
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// Get loads an upload. Expired uploads return ErrExpired until they are swept.
+func (s *Store) Get(id string) (Info, error) {
+	if !idPattern.MatchString(id) {
+		return Info{}, ErrNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return Info{}, fmt.Errorf("estado do upload %s corrompido: %w", id, err)
+	}
+
+	// O arquivo de dados é a fonte da verdade: bytes gravados antes de uma
+	// queda contam mesmo que o .info não tenha sido atualizado. Depois da
+	// entrega para processamento o arquivo some e vale o offset salvo.
+	if stat, err := os.Stat(s.DataPath(id)); err == nil {
+		info.Offset = min(stat.Size(), info.Length)
+	} else if !info.Complete() {
+		return Info{}, ErrNotFound
+	}
+
+	if s.ttl > 0 && time.Now().After(info.ExpiresAt) {
+		return info, ErrExpired
+	}
+	return info, nil
+}
+
+// Lock reserves id for a write, failing with ErrLocked if another request
+// holds it.
+func (s *Store) Lock(id string) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] {
+		return nil, ErrLocked
+	}
+	s.busy[id] = true
+	return func() {
+		s.mu.Lock()
+		delete(s.busy, id)
+		s.mu.Unlock()
+	}, nil
+}
+
+// Write appends r to the upload, which must start at offset. Bytes received
+// before a read error are kept, so the client can resume from the returned
+// offset. The caller must hold the upload's Lock.
+func (s *Store) Write(id string, offset int64, r io.Reader) (Info, error) {
+	info, err := s.Get(id)
+	if err != nil {
+		return info, err
+	}
+	if offset != info.Offset {
+		return info, ErrOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.DataPath(id), os.O_WRONLY, 0o644)
+	if err != nil {
+		return info, err
+	}
+	n, copyErr := io.Copy(io.NewOffsetWriter(f, offset), io.LimitReader(r, info.Length-offset))
+	if closeErr := f.Close(); copyErr == nil {
+		copyErr = closeErr
+	}
+	info.Offset += n
+
+	if copyErr == nil && info.Complete() {
+		// Qualquer byte além do tamanho declarado invalida a requisição
+		if extra, _ := r.Read(make([]byte, 1)); extra > 0 {
+			copyErr = ErrExceedsLength
+		}
+	}
+
+	info.ExpiresAt = s.expiry(time.Now())
+	if err := s.save(info); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	return info, copyErr
+}
+
+// Truncate discards everything after offset, e.g. a chunk whose signature
+// did not match. The caller must hold the upload's Lock.
+func (s *Store) Truncate(id string, offset int64) error {
+	info, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Truncate(s.DataPath(id), offset); err != nil {
+		return err
+	}
+	info.Offset = offset
+	return s.save(info)
+}
+
+// SetJobID records that the complete upload was handed off to jobID. The
+// caller must hold the upload's Lock.
+func (s *Store) SetJobID(id, jobID string) error {
+	info, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	info.JobID = jobID
+	return s.save(info)
+}
+
+// Terminate removes the upload. Once handed off, the data file belongs to
+// the job and is left alone.
+func (s *Store) Terminate(id string) error {
+	info, err := s.Get(id)
+	if err != nil && !errors.Is(err, ErrExpired) {
+		return err
+	}
+	if info.JobID == "" {
+		_ = os.Remove(s.DataPath(id))
+	}
+	return os.Remove(s.infoPath(id))
+}
+
+// DataPath is where the bytes of upload id are written.
+func (s *Store) DataPath(id string) string { return filepath.Join(s.dir, id+".bin") }
+
+func (s *Store) infoPath(id string) string { return filepath.Join(s.dir, id+".info") }
+
+func (s *Store) expiry(from time.Time) time.Time {
+	if s.ttl <= 0 {
+		return time.Time{}
+	}
+	return from.Add(s.ttl)
+}
+
+// save grava o .info em um arquivo temporário e renomeia, para que leituras
+// concorrentes nunca vejam um JSON pela metade.
+func (s *Store) save(info Info) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, info.ID+".info-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.infoPath(info.ID))
+}
+
+// sweep remove uploads expirados que não estão em uso. Os dados de uploads
+// já entregues a um job ficam com o job.
+func (s *Store) sweep() {
+	if s.ttl <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok {
+			continue
+		}
+		if _, err := s.Get(id); !errors.Is(err, ErrExpired) {
+			continue
+		}
+		unlock, err := s.Lock(id)
+		if err != nil {
+			continue
+		}
+		// Como em Terminate, o .bin de um upload entregue a um job pertence ao job
+		_ = s.Terminate(id)
+		unlock()
+	}
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,68 @@
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Parâmetros de query adicionados às URLs assinadas.
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+var (
+	ErrMissingSignature = errors.New("URL sem assinatura")
+	ErrInvalidSignature = errors.New("assinatura da URL inválida")
+	ErrExpired          = errors.New("URL expirada")
+)
+
+// Signer produces and checks HMAC-SHA256 signatures binding a resource name
+// to an expiry time.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(secret string) *Signer {
+	return &Signer{key: []byte(secret)}
+}
+
+// Sign returns the query parameters granting access to resource until expires.
+func (s *Signer) Sign(resource string, expires time.Time) url.Values {
+	unix := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		ExpiresParam:   {unix},
+		SignatureParam: {s.mac(resource, unix)},
+	}
+}
+
+// Verify checks the parameters produced by Sign for resource.
+func (s *Signer) Verify(resource string, query url.Values, now time.Time) error {
+	expires, signature := query.Get(ExpiresParam), query.Get(SignatureParam)
+	if expires == "" && signature == "" {
+		return ErrMissingSignature
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.mac(resource, expires))) {
+		return ErrInvalidSignature
+	}
+	if now.After(time.Unix(unix, 0)) {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (s *Signer) mac(resource, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(resource + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}